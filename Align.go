@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// alignedPair is a string of one release together with its counterpart in
+// the other.
+type alignedPair struct {
+	Src, Trg textEntry
+}
+
+// alignSegment is a run of entries of a script under the same label.
+type alignSegment struct {
+	Label   string
+	Entries []textEntry
+}
+
+func alignSegments(entries []textEntry) (segments []alignSegment) {
+	for _, e := range entries {
+		if len(segments) == 0 || segments[len(segments)-1].Label != e.Label {
+			segments = append(segments, alignSegment{Label: e.Label})
+		}
+		last := &segments[len(segments)-1]
+		last.Entries = append(last.Entries, e)
+	}
+	return
+}
+
+// alignScore rates how likely two strings translate each other: they must be
+// of the same kind, and their lengths should be in proportion.
+func alignScore(src, trg textEntry, ratio float64) float64 {
+	if src.Kind != trg.Kind {
+		return math.Inf(-1)
+	}
+	srcLen := float64(utf8.RuneCountInString(src.Text)) + 1
+	trgLen := float64(utf8.RuneCountInString(trg.Text)) + 1
+	return 2 - math.Abs(math.Log(trgLen/(srcLen*ratio)))
+}
+
+// alignEntries pairs two lists of strings in order, skipping strings that
+// only one side has. Equal lists of kinds are paired one by one, others are
+// aligned by kind and length.
+func alignEntries(src, trg []textEntry, ratio float64) (pairs []alignedPair) {
+	if len(src) == len(trg) {
+		same := true
+		for i := range src {
+			if src[i].Kind != trg[i].Kind {
+				same = false
+				break
+			}
+		}
+		if same {
+			for i := range src {
+				pairs = append(pairs, alignedPair{src[i], trg[i]})
+			}
+			return
+		}
+	}
+	const gap = -1.0
+	n, m := len(src), len(trg)
+	score := make([][]float64, n+1)
+	for i := range score {
+		score[i] = make([]float64, m+1)
+		score[i][0] = float64(i) * gap
+	}
+	for j := 0; j <= m; j++ {
+		score[0][j] = float64(j) * gap
+	}
+	for i := 1; i <= n; i++ {
+		for j := 1; j <= m; j++ {
+			score[i][j] = math.Max(score[i-1][j]+gap, score[i][j-1]+gap)
+			score[i][j] = math.Max(score[i][j], score[i-1][j-1]+alignScore(src[i-1], trg[j-1], ratio))
+		}
+	}
+	for i, j := n, m; i > 0 && j > 0; {
+		switch {
+		case score[i][j] == score[i-1][j-1]+alignScore(src[i-1], trg[j-1], ratio):
+			pairs = append(pairs, alignedPair{src[i-1], trg[j-1]})
+			i--
+			j--
+		case score[i][j] == score[i-1][j]+gap:
+			i--
+		default:
+			j--
+		}
+	}
+	for l, r := 0, len(pairs)-1; l < r; l, r = l+1, r-1 {
+		pairs[l], pairs[r] = pairs[r], pairs[l]
+	}
+	return
+}
+
+// lengthRatio is how much longer the target text is overall, used to judge
+// the length of single pairs.
+func lengthRatio(src, trg []textEntry) float64 {
+	srcLen, trgLen := 1, 1
+	for _, e := range src {
+		srcLen += utf8.RuneCountInString(e.Text)
+	}
+	for _, e := range trg {
+		trgLen += utf8.RuneCountInString(e.Text)
+	}
+	return float64(trgLen) / float64(srcLen)
+}
+
+// alignScript aligns the strings of one script. Scripts compiled from the
+// same source have the same instructions and are paired by id, others by
+// the segments between labels both releases share. A label that starts more
+// than one segment on either side can't be an anchor.
+func alignScript(src, trg []textEntry, ratio float64) (pairs []alignedPair) {
+	if len(src) == len(trg) {
+		same := true
+		for i := range src {
+			if src[i].Id != trg[i].Id {
+				same = false
+				break
+			}
+		}
+		if same {
+			for i := range src {
+				pairs = append(pairs, alignedPair{src[i], trg[i]})
+			}
+			return
+		}
+	}
+	srcSegments, trgSegments := alignSegments(src), alignSegments(trg)
+	srcLabels := map[string]bool{}
+	for _, s := range srcSegments {
+		srcLabels[s.Label] = true
+	}
+	trgByLabel := map[string][]textEntry{}
+	for _, s := range trgSegments {
+		trgByLabel[s.Label] = append(trgByLabel[s.Label], s.Entries...)
+	}
+	if len(srcLabels) < len(srcSegments) || len(trgByLabel) < len(trgSegments) || len(srcSegments) == 1 && srcSegments[0].Label == "" {
+		// no usable anchors, align the whole script
+		return alignEntries(src, trg, ratio)
+	}
+	for _, s := range srcSegments {
+		pairs = append(pairs, alignEntries(s.Entries, trgByLabel[s.Label], ratio)...)
+	}
+	return
+}
+
+func groupByScript(entries []textEntry) (names []string, scripts map[string][]textEntry) {
+	scripts = map[string][]textEntry{}
+	for _, e := range entries {
+		if _, ok := scripts[e.Script]; !ok {
+			names = append(names, e.Script)
+		}
+		scripts[e.Script] = append(scripts[e.Script], e)
+	}
+	return
+}
+
+func writeAlignedTsv(fileName string, pairs []alignedPair) error {
+	var bf bytes.Buffer
+	bf.WriteString("\ufeff")
+	w := csv.NewWriter(&bf)
+	w.Comma = '\t'
+	w.UseCRLF = true
+	w.Write([]string{"SourceID", "TargetID", "Label", "Kind", "Source", "Target"})
+	for _, p := range pairs {
+		w.Write([]string{p.Src.Id, p.Trg.Id, p.Src.Label, p.Src.Kind, p.Src.Text, p.Trg.Text})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, bf.Bytes(), os.ModePerm)
+}
+
+// alignReleases pairs the strings of two releases of a game in different
+// languages and writes them as tsv or tmx.
+func alignReleases(srcDir, trgDir, outName, srcLang, trgLang string, key []byte, guessKey bool, ops *[256]string, srcCodePage, trgCodePage int) bool {
+	trgOps := *ops
+	srcEntries, err := loadTextEntries(srcDir, key, guessKey, ops, srcCodePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	trgEntries, err := loadTextEntries(trgDir, key, guessKey, &trgOps, trgCodePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	ratio := lengthRatio(srcEntries, trgEntries)
+	logf("target text is %.2f times as long\n", ratio)
+	names, srcScripts := groupByScript(srcEntries)
+	trgNames, trgScripts := groupByScript(trgEntries)
+	var pairs []alignedPair
+	for _, name := range names {
+		trg, ok := trgScripts[name]
+		if !ok {
+			fmt.Printf("%s: only in %s\n", name, srcDir)
+			continue
+		}
+		scriptPairs := alignScript(srcScripts[name], trg, ratio)
+		logf("%s: aligned %d of %d/%d strings\n", name, len(scriptPairs), len(srcScripts[name]), len(trg))
+		pairs = append(pairs, scriptPairs...)
+	}
+	for _, name := range trgNames {
+		if _, ok := srcScripts[name]; !ok {
+			fmt.Printf("%s: only in %s\n", name, trgDir)
+		}
+	}
+	fmt.Printf("aligned %d of %d/%d strings\n", len(pairs), len(srcEntries), len(trgEntries))
+	logln("writing:", outName)
+	switch strings.ToLower(filepath.Ext(outName)) {
+	case ".tmx":
+		tm := newTranslationMemory()
+		for _, p := range pairs {
+			tm.add(p.Src.Text, p.Trg.Text, 1)
+		}
+		err = writeTmx(outName, tm, srcLang, trgLang)
+	case ".tsv":
+		err = writeAlignedTsv(outName, pairs)
+	default:
+		err = fmt.Errorf("unknown alignment file type: %s", outName)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logln("complete.")
+	return true
+}
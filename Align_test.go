@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// alignTestEntries makes entries of a script from label:kind:length specs,
+// with ids numbered from first.
+func alignTestEntries(first int, specs ...string) (entries []textEntry) {
+	for i, spec := range specs {
+		var label, kind string
+		var n int
+		fmt.Sscanf(strings.ReplaceAll(spec, ":", " "), "%s %s %d", &label, &kind, &n)
+		if label == "-" {
+			label = ""
+		}
+		entries = append(entries, textEntry{
+			Id:    fmt.Sprintf("yst00000:%d:0", first+i),
+			Label: label,
+			Kind:  kind,
+			Text:  strings.Repeat("x", n) + fmt.Sprint(first+i),
+		})
+	}
+	return
+}
+
+// pairIds lists the aligned pairs as src=trg by instruction.
+func pairIds(pairs []alignedPair) (ids []string) {
+	for _, p := range pairs {
+		ids = append(ids, strings.Split(p.Src.Id, ":")[1]+"="+strings.Split(p.Trg.Id, ":")[1])
+	}
+	return
+}
+
+func TestAlignScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, trg []textEntry
+		want     []string
+	}{
+		{
+			"same ids",
+			alignTestEntries(0, "-:message:10", "-:choice:3", "-:message:40"),
+			alignTestEntries(0, "-:message:30", "-:message:3", "-:message:1"),
+			[]string{"0=0", "1=1", "2=2"},
+		},
+		{
+			"target missing a string",
+			alignTestEntries(0, "-:message:10", "-:message:40", "-:message:5", "-:message:20"),
+			alignTestEntries(10, "-:message:10", "-:message:5", "-:message:20"),
+			[]string{"0=10", "2=11", "3=12"},
+		},
+		{
+			"kind mismatch",
+			alignTestEntries(0, "-:message:10", "-:choice:5", "-:message:10"),
+			alignTestEntries(10, "-:message:10", "-:message:5", "-:message:10"),
+			[]string{"0=10", "2=12"},
+		},
+		{
+			"label anchors",
+			alignTestEntries(0, "a:message:10", "a:message:20", "b:message:5", "b:message:30"),
+			alignTestEntries(10, "b:message:5", "b:message:30", "a:message:10", "a:message:20"),
+			[]string{"0=12", "1=13", "2=10", "3=11"},
+		},
+		{
+			"duplicate target label",
+			alignTestEntries(0, "a:message:10", "b:message:20", "a:message:5"),
+			alignTestEntries(10, "a:message:10", "b:message:20", "a:message:5", "c:message:1"),
+			[]string{"0=10", "1=11", "2=12"},
+		},
+		{
+			"duplicate source label",
+			alignTestEntries(0, "a:message:10", "b:message:20", "a:message:5"),
+			alignTestEntries(10, "a:message:10", "b:message:20"),
+			[]string{"0=10", "1=11"},
+		},
+	}
+	for _, tt := range tests {
+		got := pairIds(alignScript(tt.src, tt.trg, 1))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: alignScript = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAlignEntries(t *testing.T) {
+	src := alignTestEntries(0, "-:message:10", "-:message:10", "-:message:10")
+	trg := alignTestEntries(10, "-:message:20", "-:message:20", "-:message:20")
+	// equal kinds are paired one by one whatever their length
+	if got, want := pairIds(alignEntries(src, trg, 1)), []string{"0=10", "1=11", "2=12"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("alignEntries = %v, want %v", got, want)
+	}
+	if got := alignEntries(src, nil, 1); len(got) != 0 {
+		t.Errorf("alignEntries with an empty target = %v", pairIds(got))
+	}
+	if ratio := lengthRatio(src, trg); ratio < 1.9 || ratio > 2 {
+		t.Errorf("lengthRatio = %v", ratio)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// charMap substitutes characters the code page of the game cannot encode by
+// code points of it, usually unused ones whose glyphs are patched into the
+// font.
+type charMap struct {
+	Encode map[rune][]byte
+	Decode map[string]rune
+}
+
+var gCharMap charMap
+
+// gUnencodable counts the characters that were neither in the code page nor
+// in the substitution table when packing.
+var gUnencodable = map[rune]int{}
+
+// parseCharMapKey accepts a character or its code point as U+XXXX.
+func parseCharMapKey(s string) (rune, error) {
+	if len(s) > 2 && (strings.HasPrefix(s, "U+") || strings.HasPrefix(s, "u+")) {
+		v, err := strconv.ParseUint(s[2:], 16, 32)
+		if err != nil {
+			return 0, err
+		}
+		return rune(v), nil
+	}
+	if utf8.RuneCountInString(s) != 1 {
+		return 0, fmt.Errorf("expected one character or U+XXXX, got %q", s)
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r, nil
+}
+
+// parseCharMapValue accepts the bytes of the replacement code point in hex,
+// like 81AD, 0x81AD or 81 AD.
+func parseCharMapValue(s string) ([]byte, error) {
+	s = strings.ReplaceAll(s, " ", "")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	b, err := hex.DecodeString(s)
+	if err == nil && len(b) == 0 {
+		err = fmt.Errorf("empty code point")
+	}
+	return b, err
+}
+
+// readCharMap reads a UTF-8 substitution table with one mapping like é=81AD
+// or U+00E9=81AD per line. Empty lines and lines starting with # are ignored.
+func readCharMap(fileName string) (cm charMap, err error) {
+	stm, err := os.ReadFile(fileName)
+	if err != nil {
+		return
+	}
+	ls := strings.Split(string(bytes.TrimPrefix(stm, []byte("\ufeff"))), "\n")
+	cm.Encode = map[rune][]byte{}
+	cm.Decode = map[string]rune{}
+	for i, l := range ls {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		// the character itself may be a =
+		sep := strings.LastIndex(l, "=")
+		if sep <= 0 {
+			err = fmt.Errorf("line %d: expected <char>=<code>", i+1)
+			return
+		}
+		r, err1 := parseCharMapKey(strings.TrimSpace(l[:sep]))
+		if err1 != nil {
+			err = fmt.Errorf("line %d: %v", i+1, err1)
+			return
+		}
+		b, err1 := parseCharMapValue(l[sep+1:])
+		if err1 != nil {
+			err = fmt.Errorf("line %d: %v", i+1, err1)
+			return
+		}
+		if other, ok := cm.Decode[string(b)]; ok {
+			err = fmt.Errorf("line %d: %X is already used for %c", i+1, b, other)
+			return
+		}
+		cm.Encode[r] = b
+		cm.Decode[string(b)] = r
+	}
+	logf("read %d character substitutions\n", len(cm.Encode))
+	return
+}
+
+// printUnencodable lists the characters replaced while packing, most
+// frequent first.
+func printUnencodable() {
+	if len(gUnencodable) == 0 {
+		return
+	}
+	var chars []rune
+	for r := range gUnencodable {
+		chars = append(chars, r)
+	}
+	sort.Slice(chars, func(i, j int) bool {
+		if gUnencodable[chars[i]] != gUnencodable[chars[j]] {
+			return gUnencodable[chars[i]] > gUnencodable[chars[j]]
+		}
+		return chars[i] < chars[j]
+	})
+	fmt.Println("characters not in the code page or the -charmap table:")
+	for _, r := range chars {
+		fmt.Printf("\t%c\tU+%04X\t%dx\n", r, r, gUnencodable[r])
+	}
+}
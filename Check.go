@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// gameFiles are the parsed files of a game directory.
+type gameFiles struct {
+	Scripts   map[uint32]*ystbInfo
+	Commands  *yscmInfo
+	Labels    *yslbInfo
+	List      *ystlInfo
+	Variables *ysvrInfo
+	Totals    *ystdInfo
+	Versions  map[string]uint32
+}
+
+// loadGameFiles parses every ybn of a directory. Files that fail to parse are
+// reported as problems.
+func loadGameFiles(dir string, key []byte, guessKey bool, ops *[256]string, codePage int) (game *gameFiles, problems []string, err error) {
+	files, err := listYbnFiles(dir)
+	if err != nil {
+		return
+	}
+	guessProjectOps(files, key, guessKey, ops)
+	game = &gameFiles{Scripts: map[uint32]*ystbInfo{}, Versions: map[string]uint32{}}
+	for _, file := range files {
+		stm, e := os.ReadFile(file)
+		if e != nil {
+			return nil, nil, e
+		}
+		base := filepath.Base(file)
+		var parseErr error
+		switch ybnMagic(stm) {
+		case "YSTB":
+			id, ok := scriptIdOfName(file)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: script without id in its name", base))
+				continue
+			}
+			fileKey := key
+			if guessKey {
+				fileKey = guessYstbKey(stm)
+			}
+			script, e := parseYstb(stm, fileKey, "")
+			if parseErr = e; e == nil {
+				if !guessYstbOp(&script, ops) {
+					problems = append(problems, fmt.Sprintf("%s: can't guess the opcode", base))
+				}
+				game.Scripts[id] = &script
+				game.Versions[base] = script.Header.Meta.Version
+			}
+		case "YSCM":
+			script, e := parseYscm(stm, codePage)
+			if parseErr = e; e == nil {
+				game.Commands = &script
+				game.Versions[base] = script.Header.Meta.Version
+			}
+		case "YSLB":
+			script, e := parseYslb(stm, codePage)
+			if parseErr = e; e == nil {
+				game.Labels = &script
+				game.Versions[base] = script.Header.Meta.Version
+			}
+		case "YSTL":
+			script, e := parseYstl(stm, codePage)
+			if parseErr = e; e == nil {
+				game.List = &script
+				game.Versions[base] = script.Header.Meta.Version
+			}
+		case "YSVR":
+			script, e := parseYsvr(stm, codePage)
+			if parseErr = e; e == nil {
+				game.Variables = &script
+				game.Versions[base] = script.Header.Meta.Version
+			}
+		case "YSTD":
+			script, e := parseYstd(stm, codePage)
+			if parseErr = e; e == nil {
+				game.Totals = &script
+				game.Versions[base] = script.Header.Meta.Version
+			}
+		}
+		if parseErr != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", base, parseErr))
+		}
+	}
+	return
+}
+
+// counts returns the number of labels, messages and static variables of
+// every script, as yst_list.ybn holds them. Global variables are shared by
+// all scripts, they aren't counted for the one declaring them.
+func (game *gameFiles) counts(ops *[256]string) (labels, texts, vars map[uint32]int) {
+	labels, texts, vars = map[uint32]int{}, map[uint32]int{}, map[uint32]int{}
+	if game.Labels != nil {
+		for _, label := range game.Labels.Labels {
+			labels[uint32(label.ScriptId)]++
+		}
+	}
+	if game.Variables != nil {
+		for _, v := range game.Variables.Data {
+			if ysvrScopes[v.Header.Scope] == "static" {
+				vars[uint32(v.Header.ScriptId)]++
+			}
+		}
+	}
+	for id, script := range game.Scripts {
+		for i := range script.Insts {
+			if ops[script.Insts[i].Op] == "msg" {
+				texts[id]++
+			}
+		}
+	}
+	return
+}
+
+// check validates the files of a game against each other: labels point
+// into existing scripts, the script list and totals agree with the scripts,
+// jumps go to existing labels and all opcodes are known commands.
+func (game *gameFiles) check(ops *[256]string, codePage int) (problems []string) {
+	report := func(format string, a ...any) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+	var ids []int
+	for id := range game.Scripts {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	var versionFiles []string
+	for name := range game.Versions {
+		versionFiles = append(versionFiles, name)
+	}
+	sort.Strings(versionFiles)
+	for _, name := range versionFiles {
+		if v, first := game.Versions[name], game.Versions[versionFiles[0]]; v != first {
+			report("%s: version %d, %s has %d", name, v, versionFiles[0], first)
+		}
+	}
+
+	labelCounts, textCounts, varCounts := game.counts(ops)
+	labelNames := map[string]bool{}
+	if game.Labels == nil {
+		report("ysl.ybn: missing")
+	} else {
+		for _, label := range game.Labels.Labels {
+			labelNames[label.Name] = true
+			script, ok := game.Scripts[uint32(label.ScriptId)]
+			if !ok {
+				report("ysl.ybn: label %s is in missing script yst%05d", label.Name, label.ScriptId)
+				continue
+			}
+			if label.CommandIndex >= script.Header.InstCnt {
+				report("ysl.ybn: label %s at instruction %d, yst%05d has %d", label.Name, label.CommandIndex, label.ScriptId, script.Header.InstCnt)
+			}
+		}
+	}
+
+	if game.Variables != nil {
+		for _, v := range game.Variables.Data {
+			if _, ok := game.Scripts[uint32(v.Header.ScriptId)]; !ok {
+				report("ysv.ybn: variable %d is in missing script yst%05d", v.Header.VarIndex, v.Header.ScriptId)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		script := game.Scripts[uint32(id)]
+		for i := range script.Insts {
+			inst := &script.Insts[i]
+			if game.Commands == nil {
+				continue
+			}
+			if int(inst.Op) >= len(game.Commands.Commands) {
+				report("yst%05d:%d: opcode %d, ysc.ybn has %d commands", id, i, inst.Op, len(game.Commands.Commands))
+				continue
+			}
+			name := strings.ToUpper(game.Commands.Commands[inst.Op].Name)
+			if (name == "JUMP" || name == "GOSUB") && len(inst.Args) > 0 && game.Labels != nil {
+				if target := argLabel(&inst.Args[0], nil, codePage); target != "" && !labelNames[target] {
+					report("yst%05d:%d: %s to missing label %s", id, i, name, target)
+				}
+			}
+		}
+	}
+	if game.Commands == nil {
+		report("ysc.ybn: missing")
+	}
+
+	if game.List == nil {
+		report("yst_list.ybn: missing")
+		return
+	}
+	listed := map[uint32]bool{}
+	var vars, texts uint32
+	for _, scr := range game.List.Scripts {
+		listed[scr.Id] = true
+		vars += scr.VarCount
+		texts += scr.TxtCount
+		if _, ok := game.Scripts[scr.Id]; !ok {
+			report("yst_list.ybn: yst%05d (%s) is missing", scr.Id, scr.Source)
+			continue
+		}
+		if game.Labels != nil && int(scr.LblCount) != labelCounts[scr.Id] {
+			report("yst_list.ybn: yst%05d has LblCount %d, ysl.ybn %d labels", scr.Id, scr.LblCount, labelCounts[scr.Id])
+		}
+		if int(scr.TxtCount) != textCounts[scr.Id] {
+			report("yst_list.ybn: yst%05d has TxtCount %d, the script %d messages", scr.Id, scr.TxtCount, textCounts[scr.Id])
+		}
+		if game.Variables != nil && int(scr.VarCount) != varCounts[scr.Id] {
+			report("yst_list.ybn: yst%05d has VarCount %d, ysv.ybn %d static variables", scr.Id, scr.VarCount, varCounts[scr.Id])
+		}
+	}
+	for _, id := range ids {
+		if !listed[uint32(id)] {
+			report("yst%05d.ybn: not in yst_list.ybn", id)
+		}
+	}
+	if game.Totals != nil {
+		if game.Totals.Header.VarCount != vars {
+			report("yst.ybn: VarCount %d, yst_list.ybn sums to %d", game.Totals.Header.VarCount, vars)
+		}
+		if game.Totals.Header.TextCount != texts {
+			report("yst.ybn: TextCount %d, yst_list.ybn sums to %d", game.Totals.Header.TextCount, texts)
+		}
+	}
+	return
+}
+
+// checkGameFiles prints the problems found in a game directory and tells
+// whether there were none.
+func checkGameFiles(dir string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	game, problems, err := loadGameFiles(dir, key, guessKey, ops, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	problems = append(problems, game.check(ops, codePage)...)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) != 0 {
+		fmt.Printf("%d problems found\n", len(problems))
+		return false
+	}
+	fmt.Printf("%d scripts checked, no problems found\n", len(game.Scripts))
+	return true
+}
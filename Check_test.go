@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/regomne/eutil/codec"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLoadGameFilesCorrupt checks that corrupt counts are reported as
+// problems instead of being allocated.
+func TestLoadGameFilesCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"ysl.ybn":      ybnBytes("YSLB", uint32(0x7FFFFFFF)),
+		"yst_list.ybn": ybnBytes("YSTL", uint32(0x7FFFFFFF)),
+		"ysc.ybn":      ybnBytes("YSCM", uint32(0x7FFFFFFF), uint32(0)),
+		"ysv.ybn":      ybnBytes("YSVR", uint16(1), ysvrVariableHeader{1, 0, 1, 3, 0}, uint16(0xFFFF)),
+	}
+	for name, stm := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), stm, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ops [256]string
+	_, problems, err := loadGameFiles(dir, nil, false, &ops, codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ysc.ybn: 2147483647 commands exceed the file",
+		"ysl.ybn: label range index truncated",
+		"yst_list.ybn: 2147483647 scripts exceed the file",
+		"ysv.ybn: variable 0 (index 1): value truncated",
+	}
+	if strings.Join(problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems:\n%s\nwant:\n%s", strings.Join(problems, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseCorruptCounts(t *testing.T) {
+	if _, err := parseYslb(ybnBytes("YSLB", uint32(0x7FFFFFFF), [256]uint32{}), codec.C932); err == nil || !strings.Contains(err.Error(), "exceed the file") {
+		t.Errorf("parseYslb = %v", err)
+	}
+	stm := ybnBytes("YSTL", uint32(1), uint32(0), uint32(0xFFFFFFF0), make([]byte, 24))
+	if _, err := parseYstl(stm, codec.C932); err == nil || !strings.Contains(err.Error(), "exceeds the file") {
+		t.Errorf("parseYstl = %v", err)
+	}
+}
+
+func TestGameCounts(t *testing.T) {
+	var ops [256]string
+	game := &gameFiles{
+		Labels: &yslbInfo{Labels: []yslbLabel{{ScriptId: 0}, {ScriptId: 1}, {ScriptId: 1}}},
+		Variables: &ysvrInfo{Data: []ysvrVariable{
+			{Header: ysvrVariableHeader{Scope: 1, ScriptId: 0}},
+			{Header: ysvrVariableHeader{Scope: 2, ScriptId: 1}},
+			{Header: ysvrVariableHeader{Scope: 2, ScriptId: 1}},
+			{Header: ysvrVariableHeader{Scope: 1, ScriptId: 1}},
+		}},
+	}
+	labels, _, vars := game.counts(&ops)
+	if labels[0] != 1 || labels[1] != 2 {
+		t.Errorf("labels = %v", labels)
+	}
+	if vars[0] != 0 || vars[1] != 2 {
+		t.Errorf("static variables = %v, want 0 and 2", vars)
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/regomne/eutil/codec"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Code pages not known to codec. codec.C932, codec.C936 and codec.UTF8 are
+// used as they are.
+const (
+	cpAuto = -2
+	cp949  = 100
+	cp950  = 101
+	cp1252 = 102
+)
+
+var codePageNames = map[string]int{
+	"932":       codec.C932,
+	"sjis":      codec.C932,
+	"shift-jis": codec.C932,
+	"shiftjis":  codec.C932,
+	"936":       codec.C936,
+	"gbk":       codec.C936,
+	"949":       cp949,
+	"euc-kr":    cp949,
+	"uhc":       cp949,
+	"950":       cp950,
+	"big5":      cp950,
+	"1252":      cp1252,
+	"latin1":    cp1252,
+	"65001":     codec.UTF8,
+	"utf8":      codec.UTF8,
+	"utf-8":     codec.UTF8,
+	"auto":      cpAuto,
+}
+
+// detectableCodePages are tried in this order by -cp auto.
+var detectableCodePages = []int{codec.C932, codec.C936, cp949, cp950, cp1252, codec.UTF8}
+
+func parseCp(s string) (int, error) {
+	cp, ok := codePageNames[strings.ToLower(s)]
+	if !ok {
+		return codec.Unknown, fmt.Errorf("unknown code page %s, use 932, 936, 949, 950, 1252, utf-8 or auto", s)
+	}
+	return cp, nil
+}
+
+func cpName(cp int) string {
+	switch cp {
+	case codec.C932:
+		return "932"
+	case codec.C936:
+		return "936"
+	case cp949:
+		return "949"
+	case cp950:
+		return "950"
+	case cp1252:
+		return "1252"
+	case codec.UTF8:
+		return "utf-8"
+	}
+	return "unknown"
+}
+
+// cpEncoding returns the encoding of a code page, nil for UTF-8.
+func cpEncoding(cp int) encoding.Encoding {
+	switch cp {
+	case codec.C932:
+		return japanese.ShiftJIS
+	case codec.C936:
+		return simplifiedchinese.GBK
+	case cp949:
+		return korean.EUCKR
+	case cp950:
+		return traditionalchinese.Big5
+	case cp1252:
+		return charmap.Windows1252
+	case codec.UTF8, codec.UTF8Sig:
+		return nil
+	}
+	panic(fmt.Sprintf("unsupported code page %d", cp))
+}
+
+// byteEscapeRegex matches the escapes decodeText writes for bytes that do not
+// survive decoding and encoding again, like \x{81AD}.
+var byteEscapeRegex = regexp.MustCompile(`\\x\{((?:[0-9A-Fa-f]{2})+)\}`)
+
+// encodeText encodes s in the code page of the game. Escapes like \x{81AD}
+// are written as their bytes and characters of the substitution table as
+// their code point. Other characters the code page lacks are replaced and
+// counted in gUnencodable.
+func encodeText(s string, cp int) []byte {
+	var out []byte
+	pos := 0
+	for _, m := range byteEscapeRegex.FindAllStringSubmatchIndex(s, -1) {
+		out = append(out, encodeChars(s[pos:m[0]], cp, gUnencodable)...)
+		b, _ := hex.DecodeString(s[m[2]:m[3]])
+		out = append(out, b...)
+		pos = m[1]
+	}
+	return append(out, encodeChars(s[pos:], cp, gUnencodable)...)
+}
+
+func encodeChars(s string, cp int, unencodable map[rune]int) []byte {
+	enc := cpEncoding(cp)
+	if enc == nil {
+		return []byte(s)
+	}
+	encoder := enc.NewEncoder()
+	var out []byte
+	for _, r := range s {
+		if b, ok := gCharMap.Encode[r]; ok {
+			out = append(out, b...)
+			continue
+		}
+		b, err := encoder.Bytes([]byte(string(r)))
+		if err != nil {
+			if unencodable != nil {
+				unencodable[r]++
+			}
+			b = []byte{encoding.ASCIISub}
+		}
+		out = append(out, b...)
+	}
+	return out
+}
+
+// isLeadByte tells whether b starts a double-byte character.
+func isLeadByte(b byte, cp int) bool {
+	switch cp {
+	case codec.C932:
+		return b >= 0x81 && b <= 0x9F || b >= 0xE0 && b <= 0xFC
+	case codec.C936, cp949, cp950:
+		return b >= 0x81 && b <= 0xFE
+	}
+	return false
+}
+
+// splitChars splits encoded text into the bytes of each character.
+func splitChars(b []byte, cp int) [][]byte {
+	var chars [][]byte
+	for len(b) > 0 {
+		n := 1
+		if cp == codec.UTF8 || cp == codec.UTF8Sig {
+			_, n = utf8.DecodeRune(b)
+		} else if isLeadByte(b[0], cp) && len(b) > 1 {
+			n = 2
+		}
+		chars = append(chars, b[:n])
+		b = b[n:]
+	}
+	return chars
+}
+
+// decodeText decodes a string of the game so that encodeText gives back the
+// same bytes. Characters that do not survive this, like invalid bytes or
+// duplicates of vendor extensions, are written as escapes like \x{81AD}, a
+// backslash starting such an escape as \x{5C}. Code points of the
+// substitution table become their characters.
+func decodeText(b []byte, cp int) string {
+	if len(gCharMap.Decode) == 0 && !bytes.Contains(b, []byte(`\x{`)) {
+		s := decodeChars(b, cp)
+		if bytes.Equal(encodeChars(s, cp, nil), b) {
+			return s
+		}
+	}
+	var sb strings.Builder
+	pos := 0
+	for _, c := range splitChars(b, cp) {
+		pos += len(c)
+		if r, ok := gCharMap.Decode[string(c)]; ok {
+			sb.WriteRune(r)
+			continue
+		}
+		s := decodeChars(c, cp)
+		if !bytes.Equal(encodeChars(s, cp, nil), c) || s == `\` && bytes.HasPrefix(b[pos:], []byte("x{")) {
+			fmt.Fprintf(&sb, `\x{%X}`, c)
+		} else {
+			sb.WriteString(s)
+		}
+	}
+	return sb.String()
+}
+
+func decodeChars(b []byte, cp int) string {
+	enc := cpEncoding(cp)
+	if enc == nil {
+		return strings.ToValidUTF8(string(b), "\ufffd")
+	}
+	s, err := enc.NewDecoder().Bytes(b)
+	if err != nil {
+		panic(err)
+	}
+	return string(s)
+}
+
+// frequentHanzi are the most common characters of Chinese text, in simplified
+// and traditional form. Japanese decoded as GBK or Big5 rarely hits them.
+const frequentHanzi = "的一是不了人我在有他这這中大来來上国國个個到说說们們为為子和你地出道也时時年就那要下以生会會自着著去之过過家学學对對可她里裡后後小么麼心多天而能好都然没沒日于於起还還发發成事只作当當想看文无無开開手十用主行方又如前所本见見经經头頭面公同三已老从從动動两兩长長"
+
+// cpRuneScore rates how likely r is in text of code page cp.
+func cpRuneScore(r rune, cp int) float64 {
+	switch {
+	case r == utf8.RuneError:
+		return -5
+	case r < 0x80:
+		return 0
+	case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) && r < 0xFF00:
+		if cp == codec.C932 || cp == codec.UTF8 {
+			return 2
+		}
+		return 0.5
+	case unicode.Is(unicode.Hangul, r):
+		if cp == cp949 || cp == codec.UTF8 {
+			return 2
+		}
+		return 0.5
+	case strings.ContainsRune(frequentHanzi, r):
+		return 2
+	case unicode.Is(unicode.Han, r):
+		return 0.5
+	case r >= 0x3000 && r <= 0x303F, r >= 0xFF01 && r <= 0xFF5E:
+		// CJK and full-width punctuation
+		return 1
+	case r >= 0xC0 && r <= 0xFF && unicode.IsLetter(r):
+		return 1
+	case unicode.IsPunct(r) || unicode.IsSpace(r):
+		return 0
+	}
+	return -1
+}
+
+type cpScore struct {
+	CodePage int
+	Score    float64
+}
+
+// detectCodePage rates every detectable code page by how plausible the
+// samples decode in it, best first.
+func detectCodePage(samples [][]byte) []cpScore {
+	scores := make([]cpScore, len(detectableCodePages))
+	for i, cp := range detectableCodePages {
+		scores[i].CodePage = cp
+		count := 0
+		for _, sample := range samples {
+			s := string(sample)
+			if cp != codec.UTF8 {
+				s = decodeChars(sample, cp)
+			}
+			for _, r := range s {
+				if r >= 0x80 {
+					scores[i].Score += cpRuneScore(r, cp)
+					count++
+				}
+			}
+		}
+		if count > 0 {
+			scores[i].Score /= float64(count)
+		}
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Score > scores[j].Score
+	})
+	return scores
+}
+
+// sampleStrings collects the runs of printable bytes with non-ASCII
+// characters, which is where the text of any ybn is.
+func sampleStrings(stm []byte) (samples [][]byte) {
+	start := 0
+	high := false
+	for i := 0; i <= len(stm); i++ {
+		if i == len(stm) || stm[i] < 0x20 {
+			if high && i-start >= 4 {
+				samples = append(samples, stm[start:i])
+			}
+			start = i + 1
+			high = false
+		} else if stm[i] >= 0x80 {
+			high = true
+		}
+	}
+	return
+}
+
+// detectInputCodePage samples a ybn or the ybn files of a directory and
+// prints how likely each code page is.
+func detectInputCodePage(inputName string, key []byte, guessKey bool) int {
+	files := []string{inputName}
+	if isDir(inputName) {
+		files, _ = listYbnFiles(inputName)
+	}
+	var samples [][]byte
+	for _, file := range files {
+		stm, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if ybnMagic(stm) == "YSTB" {
+			fileKey := key
+			if guessKey {
+				fileKey = guessYstbKey(stm)
+			}
+			if _, err := parseYstb(stm, fileKey, ""); err != nil {
+				continue
+			}
+		}
+		samples = append(samples, sampleStrings(stm)...)
+	}
+	scores := detectCodePage(samples)
+	fmt.Println("code page\tscore")
+	for _, s := range scores {
+		fmt.Printf("%s\t%.3f\n", cpName(s.CodePage), s.Score)
+	}
+	fmt.Println("using code page", cpName(scores[0].CodePage))
+	return scores[0].CodePage
+}
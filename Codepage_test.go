@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/regomne/eutil/codec"
+	"math/rand"
+	"testing"
+)
+
+var testCodePages = []int{codec.C932, codec.C936, cp949, cp950, cp1252, codec.UTF8}
+
+func TestDecodeTextEscapes(t *testing.T) {
+	tests := []struct {
+		b        []byte
+		codePage int
+		want     string
+	}{
+		{[]byte("plain"), codec.C932, "plain"},
+		{[]byte{0x82, 0xA0}, codec.C932, "あ"},
+		{[]byte{0x82}, codec.C932, `\x{82}`},
+		{[]byte{0xFF, 'a'}, codec.UTF8, `\x{FF}a`},
+		{[]byte(`\x{41}`), codec.C932, `\x{5C}x{41}`},
+		{[]byte(`a\b`), codec.UTF8, `a\b`},
+	}
+	for _, tt := range tests {
+		if got := decodeText(tt.b, tt.codePage); got != tt.want {
+			t.Errorf("decodeText(%X, %d) = %q, want %q", tt.b, tt.codePage, got, tt.want)
+		}
+	}
+}
+
+// TestDecodeTextRoundTrip checks that every byte string survives decoding
+// and encoding again, in every code page.
+func TestDecodeTextRoundTrip(t *testing.T) {
+	samples := [][]byte{
+		{},
+		[]byte("ascii text"),
+		[]byte(`\x{81AD} literal escape`),
+		{0x81, 0x40, 0x82, 0xA0, 0x87, 0x40, 0xED, 0x40, 0xFA, 0x40},
+		{0x81},
+		{0xA4, 0xA4, 0xFF, 0xFE},
+		{0x5C, 0x78, 0x7B, 0x82, 0x7D},
+		{0xE3, 0x81, 0x82, 0xE3, 0x81},
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		b := make([]byte, rnd.Intn(24))
+		rnd.Read(b)
+		samples = append(samples, b)
+	}
+	for _, cp := range testCodePages {
+		for _, b := range samples {
+			s := decodeText(b, cp)
+			if got := encodeText(s, cp); !bytes.Equal(got, b) {
+				t.Errorf("code page %d: %X -> %q -> %X", cp, b, s, got)
+			}
+		}
+	}
+}
+
+func TestYserRoundTrip(t *testing.T) {
+	var stm bytes.Buffer
+	header := yserHeader{Count: 3}
+	copy(header.Meta.Magic[:], "YSER")
+	header.Meta.Version = 0x1D4
+	binary.Write(&stm, binary.LittleEndian, &header)
+	for i, msg := range [][]byte{
+		[]byte("error"),
+		{0x83, 0x47, 0x83, 0x89, 0x81, 0x5B, 0x81},
+		{0x5C, 0x78, 0x7B, 0x46, 0x46, 0x7D, 0xFD},
+	} {
+		binary.Write(&stm, binary.LittleEndian, uint32(i+1))
+		stm.Write(msg)
+		stm.WriteByte(0)
+	}
+	script, err := parseYser(stm.Bytes(), codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed := packTxtToYser(&script, stm.Bytes(), script.ErrorMessages, codec.C932)
+	if !bytes.Equal(packed, stm.Bytes()) {
+		t.Errorf("pack(extract(x)) =\n%X\nwant\n%X", packed, stm.Bytes())
+	}
+}
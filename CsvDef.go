@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var csvColumns = []string{"ID", "Script", "Source", "Label", "Speaker", "Kind", "Original", "Translation"}
+
+// csvSeparator returns a tab for .tsv files and a comma for everything else.
+func csvSeparator(fileName string) rune {
+	if strings.ToLower(filepath.Ext(fileName)) == ".tsv" {
+		return '\t'
+	}
+	return ','
+}
+
+// writeCsv writes one row per entry. The file starts with a BOM so
+// spreadsheet programs detect UTF-8.
+func writeCsv(fileName string, entries []textEntry) error {
+	var bf bytes.Buffer
+	bf.WriteString("\ufeff")
+	w := csv.NewWriter(&bf)
+	w.Comma = csvSeparator(fileName)
+	w.UseCRLF = true
+	w.Write(csvColumns)
+	for _, e := range entries {
+		w.Write([]string{e.Id, e.Script, e.Source, e.Label, e.Speaker, e.Kind, e.Text, e.Translation})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, bf.Bytes(), os.ModePerm)
+}
+
+// readCsvTranslations maps the ID column to the Translation column. Columns
+// are found by their header, so they may be reordered and rows may be
+// filtered or sorted freely.
+func readCsvTranslations(fileName string) (translations map[string]string, err error) {
+	stm, err := os.ReadFile(fileName)
+	if err != nil {
+		return
+	}
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(stm, []byte("\ufeff"))))
+	r.Comma = csvSeparator(fileName)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return
+	}
+	if len(rows) == 0 {
+		err = fmt.Errorf("empty file")
+		return
+	}
+	idCol, trCol := -1, -1
+	for i, name := range rows[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "id":
+			idCol = i
+		case "translation":
+			trCol = i
+		}
+	}
+	if idCol < 0 || trCol < 0 {
+		err = fmt.Errorf("missing ID or Translation column")
+		return
+	}
+	translations = map[string]string{}
+	for _, row := range rows[1:] {
+		if idCol >= len(row) || trCol >= len(row) || row[idCol] == "" || row[trCol] == "" {
+			continue
+		}
+		translations[row[idCol]] = row[trCol]
+	}
+	return
+}
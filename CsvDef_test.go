@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCsvSeparator(t *testing.T) {
+	tests := map[string]rune{"a.csv": ',', "a.tsv": '\t', "A.TSV": '\t', "a.txt": ','}
+	for name, want := range tests {
+		if got := csvSeparator(name); got != want {
+			t.Errorf("csvSeparator(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCsvRoundTrip(t *testing.T) {
+	entries := []textEntry{
+		{Id: "yst00000:1:0", Script: "yst00000", Kind: "message", Text: "a, \"b\"", Translation: "multi\nline, \"quoted\""},
+		{Id: "yst00000:2:0", Script: "yst00000", Kind: "message", Text: "tab\there", Translation: "Tab\thier"},
+		{Id: "yst00000:3:0", Script: "yst00000", Kind: "message", Text: "untranslated"},
+	}
+	want := map[string]string{"yst00000:1:0": "multi\nline, \"quoted\"", "yst00000:2:0": "Tab\thier"}
+	for _, ext := range []string{".csv", ".tsv"} {
+		name := filepath.Join(t.TempDir(), "t"+ext)
+		if err := writeCsv(name, entries); err != nil {
+			t.Fatal(err)
+		}
+		stm, _ := os.ReadFile(name)
+		if !bytes.HasPrefix(stm, []byte("\ufeffID")) {
+			t.Errorf("%s: no BOM and header: %q", ext, stm[:8])
+		}
+		got, err := readCsvTranslations(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: readCsvTranslations = %v, want %v", ext, got, want)
+		}
+	}
+}
+
+func TestReadCsvTranslations(t *testing.T) {
+	tests := []struct {
+		csv  string
+		want map[string]string
+		ok   bool
+	}{
+		{"Translation,Original, id \nT1,o,a\n,o,b\nT3\n", map[string]string{"a": "T1"}, true},
+		{"\ufeffid,translation\r\na,\"x \"\"y\"\"\"\r\n", map[string]string{"a": `x "y"`}, true},
+		{"ID,Original\na,b\n", nil, false},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "t.csv")
+		os.WriteFile(name, []byte(tt.csv), os.ModePerm)
+		got, err := readCsvTranslations(name)
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("readCsvTranslations(%q) = %v, %v", tt.csv, got, err)
+		}
+	}
+}
@@ -0,0 +1,550 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// diffChange is one semantic difference between two versions of a file.
+type diffChange struct {
+	File  string
+	Kind  string // added, removed, changed
+	Where string // instruction, label, script or field
+	Old   string `json:",omitempty"`
+	New   string `json:",omitempty"`
+}
+
+// diffEdit is one step of an edit script, Kind is '=', '-' or '+'. A and B
+// are the indexes in the old and new sequence.
+type diffEdit struct {
+	Kind byte
+	A, B int
+}
+
+// myersDiff computes the shortest edit script from a to b.
+func myersDiff(a, b []string) []diffEdit {
+	// common prefix and suffix need no search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var edits []diffEdit
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, diffEdit{'=', i, i})
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(ma), len(mb)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] holds the diagonals -d-1..d+1 of v before step d, all the
+	// backtracking needs, so memory grows with d² instead of (n+m)·d
+	var trace [][]int
+	found := n == 0 && m == 0
+	for d := 0; d <= n+m && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && ma[x] == mb[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	var middle []diffEdit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || k != d && v[k+d] < v[k+d+2] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+d+1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			middle = append(middle, diffEdit{'=', prefix + x, prefix + y})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				middle = append(middle, diffEdit{'+', prefix + x, prefix + y})
+			} else {
+				x--
+				middle = append(middle, diffEdit{'-', prefix + x, prefix + y})
+			}
+		}
+	}
+	for i := len(middle) - 1; i >= 0; i-- {
+		edits = append(edits, middle[i])
+	}
+	for i := 0; i < suffix; i++ {
+		edits = append(edits, diffEdit{'=', len(a) - suffix + i, len(b) - suffix + i})
+	}
+	return edits
+}
+
+// unifiedDiff renders an edit script as unified diff hunks with three lines
+// of context.
+func unifiedDiff(a, b []string, edits []diffEdit) string {
+	const context = 3
+	out := ""
+	for i := 0; i < len(edits); {
+		if edits[i].Kind == '=' {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(edits) {
+			if edits[end].Kind != '=' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].Kind == '=' {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end += context
+				if end > run {
+					end = run
+				}
+				break
+			}
+			end = run
+		}
+		hunk := ""
+		countA, countB := 0, 0
+		for _, e := range edits[start:end] {
+			switch e.Kind {
+			case '=':
+				hunk += " " + a[e.A] + "\n"
+				countA++
+				countB++
+			case '-':
+				hunk += "-" + a[e.A] + "\n"
+				countA++
+			case '+':
+				hunk += "+" + b[e.B] + "\n"
+				countB++
+			}
+		}
+		out += fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", edits[start].A+1, countA, edits[start].B+1, countB) + hunk
+		i = end
+	}
+	return out
+}
+
+// diffYstb compares two scripts instruction by instruction. Removed and added
+// instructions with the same op next to each other are reported as changed.
+func diffYstb(file string, oldScript, newScript *ystbInfo, ops *[256]string, codePage int) (changes []diffChange, text string) {
+	render := func(script *ystbInfo) []string {
+		lines := make([]string, len(script.Insts))
+		for i := range script.Insts {
+			lines[i] = ystbInstructLine(&script.Insts[i], ops, codePage)
+		}
+		return lines
+	}
+	a, b := render(oldScript), render(newScript)
+	edits := myersDiff(a, b)
+	for i := 0; i < len(edits); {
+		if edits[i].Kind == '=' {
+			i++
+			continue
+		}
+		var removed, added []diffEdit
+		for ; i < len(edits) && edits[i].Kind != '='; i++ {
+			if edits[i].Kind == '-' {
+				removed = append(removed, edits[i])
+			} else {
+				added = append(added, edits[i])
+			}
+		}
+		for len(removed) > 0 || len(added) > 0 {
+			switch {
+			case len(removed) > 0 && len(added) > 0 && oldScript.Insts[removed[0].A].Op == newScript.Insts[added[0].B].Op:
+				changes = append(changes, diffChange{file, "changed", fmt.Sprintf("inst %d -> %d", removed[0].A, added[0].B), a[removed[0].A], b[added[0].B]})
+				removed, added = removed[1:], added[1:]
+			case len(removed) > 0:
+				changes = append(changes, diffChange{file, "removed", fmt.Sprintf("inst %d", removed[0].A), a[removed[0].A], ""})
+				removed = removed[1:]
+			default:
+				changes = append(changes, diffChange{file, "added", fmt.Sprintf("inst %d", added[0].B), "", b[added[0].B]})
+				added = added[1:]
+			}
+		}
+	}
+	return changes, unifiedDiff(a, b, edits)
+}
+
+// diffKeyed compares two sets of records identified by a key, like labels by
+// name or scripts by id.
+func diffKeyed(file string, oldRecords, newRecords map[string]string) (changes []diffChange) {
+	var keys []string
+	for k := range oldRecords {
+		keys = append(keys, k)
+	}
+	for k := range newRecords {
+		if _, ok := oldRecords[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		o, inOld := oldRecords[k]
+		n, inNew := newRecords[k]
+		switch {
+		case !inNew:
+			changes = append(changes, diffChange{file, "removed", k, o, ""})
+		case !inOld:
+			changes = append(changes, diffChange{file, "added", k, "", n})
+		case o != n:
+			changes = append(changes, diffChange{file, "changed", k, o, n})
+		}
+	}
+	return
+}
+
+func yslbRecords(script *yslbInfo) map[string]string {
+	records := map[string]string{}
+	for _, l := range script.Labels {
+		records[l.Name] = fmt.Sprintf("Id=0x%08X yst%05d.ybn:%d", l.Id, l.ScriptId, l.CommandIndex)
+	}
+	return records
+}
+
+func ystlRecords(script *ystlInfo) map[string]string {
+	records := map[string]string{}
+	for _, s := range script.Scripts {
+		records[fmt.Sprintf("yst%05d", s.Id)] = fmt.Sprintf("%s ModificationTime=%v VarCount=%v LblCount=%v TxtCount=%v",
+			s.Source, s.ModificationTime, s.VarCount, s.LblCount, s.TxtCount)
+	}
+	return records
+}
+
+// flattenFields lists every field of a parsed file by its path, like
+// Header.ScreenWidth or Commands[3].Name.
+func flattenFields(prefix string, v reflect.Value, fields map[string]string) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := f.Name
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			flattenFields(name, v.Field(i), fields)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Array {
+				fields[prefix] = fmt.Sprint(v.Interface())
+			} else {
+				fields[prefix] = fmt.Sprintf("%X", v.Bytes())
+			}
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			flattenFields(fmt.Sprintf("%s[%d]", prefix, i), v.Index(i), fields)
+		}
+	case reflect.Interface, reflect.Pointer:
+		if !v.IsNil() {
+			flattenFields(prefix, v.Elem(), fields)
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			flattenFields(fmt.Sprintf("%s[%v]", prefix, k), v.MapIndex(k), fields)
+		}
+	default:
+		fields[prefix] = fmt.Sprint(v.Interface())
+	}
+}
+
+func fieldRecords(script interface{}) map[string]string {
+	fields := map[string]string{}
+	flattenFields("", reflect.ValueOf(script), fields)
+	return fields
+}
+
+// diffYbn compares two versions of a ybn file of the same kind. text is the
+// unified diff for scripts and empty otherwise.
+func diffYbn(file string, oldStm, newStm []byte, key []byte, guessKey bool, ops *[256]string, codePage int) (changes []diffChange, text string, err error) {
+	kind := ybnMagic(oldStm)
+	if kind != ybnMagic(newStm) {
+		changes = append(changes, diffChange{file, "changed", "format", kind, ybnMagic(newStm)})
+		return
+	}
+	switch kind {
+	case "YSTB":
+		oldKey, newKey := key, key
+		if guessKey {
+			oldKey, newKey = guessYstbKey(oldStm), guessYstbKey(newStm)
+		}
+		oldScript, e := parseYstb(oldStm, oldKey, "")
+		if e != nil {
+			return nil, "", e
+		}
+		newScript, e := parseYstb(newStm, newKey, "")
+		if e != nil {
+			return nil, "", e
+		}
+		guessYstbOp(&oldScript, ops)
+		changes, text = diffYstb(file, &oldScript, &newScript, ops, codePage)
+		return
+	case "YSLB":
+		oldScript, e := parseYslb(oldStm, codePage)
+		if e != nil {
+			return nil, "", e
+		}
+		newScript, e := parseYslb(newStm, codePage)
+		if e != nil {
+			return nil, "", e
+		}
+		return diffKeyed(file, yslbRecords(&oldScript), yslbRecords(&newScript)), "", nil
+	case "YSTL":
+		oldScript, e := parseYstl(oldStm, codePage)
+		if e != nil {
+			return nil, "", e
+		}
+		newScript, e := parseYstl(newStm, codePage)
+		if e != nil {
+			return nil, "", e
+		}
+		return diffKeyed(file, ystlRecords(&oldScript), ystlRecords(&newScript)), "", nil
+	}
+	var oldScript, newScript interface{}
+	switch kind {
+	case "YSCF":
+		oldScript, err = parseYscf(oldStm, codePage)
+		if err == nil {
+			newScript, err = parseYscf(newStm, codePage)
+		}
+	case "YSCM":
+		oldScript, err = parseYscm(oldStm, codePage)
+		if err == nil {
+			newScript, err = parseYscm(newStm, codePage)
+		}
+	case "YSER":
+		oldScript, err = parseYser(oldStm, codePage)
+		if err == nil {
+			newScript, err = parseYser(newStm, codePage)
+		}
+	case "YSTD":
+		oldScript, err = parseYstd(oldStm, codePage)
+		if err == nil {
+			newScript, err = parseYstd(newStm, codePage)
+		}
+	case "YSVR":
+		oldScript, err = parseYsvr(oldStm, codePage)
+		if err == nil {
+			newScript, err = parseYsvr(newStm, codePage)
+		}
+	default:
+		if string(oldStm) != string(newStm) {
+			changes = append(changes, diffChange{file, "changed", "content", fmt.Sprintf("%d bytes", len(oldStm)), fmt.Sprintf("%d bytes", len(newStm))})
+		}
+		return
+	}
+	if err != nil {
+		return
+	}
+	return diffKeyed(file, fieldRecords(oldScript), fieldRecords(newScript)), "", nil
+}
+
+// diffFileSets compares files of two builds by name. read returns the content
+// of a file of the old or new build.
+func diffFileSets(oldNames, newNames []string, read func(name string, isNew bool) ([]byte, error), key []byte, guessKey bool, ops *[256]string, codePage int) (changes []diffChange, text string, err error) {
+	inOld := map[string]bool{}
+	for _, n := range oldNames {
+		inOld[n] = true
+	}
+	inNew := map[string]bool{}
+	for _, n := range newNames {
+		inNew[n] = true
+	}
+	names := append([]string(nil), oldNames...)
+	for _, n := range newNames {
+		if !inOld[n] {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !inNew[name] {
+			changes = append(changes, diffChange{name, "removed", "file", "", ""})
+			continue
+		}
+		if !inOld[name] {
+			changes = append(changes, diffChange{name, "added", "file", "", ""})
+			continue
+		}
+		oldStm, e := read(name, false)
+		if e != nil {
+			return nil, "", e
+		}
+		newStm, e := read(name, true)
+		if e != nil {
+			return nil, "", e
+		}
+		cs, t, e := diffYbn(name, oldStm, newStm, key, guessKey, ops, codePage)
+		if e != nil {
+			return nil, "", fmt.Errorf("%s: %v", name, e)
+		}
+		changes = append(changes, cs...)
+		if t != "" {
+			text += "--- a/" + name + "\n+++ b/" + name + "\n" + t
+		}
+	}
+	return
+}
+
+func listYpfFiles(stm []byte, codePage int) (archive ypfInfo, names []string, files map[string]ypfEntry, err error) {
+	archive, err = parseYpf(stm, codePage)
+	if err != nil {
+		return
+	}
+	files = map[string]ypfEntry{}
+	for _, entry := range archive.ArchivedFiles {
+		names = append(names, entry.FileName)
+		files[entry.FileName] = entry
+	}
+	return
+}
+
+// diffInputs compares two ybn files, two directories of ybn files or two YPF
+// archives.
+func diffInputs(oldName, newName string, key []byte, guessKey bool, ops *[256]string, codePage int) (changes []diffChange, text string, err error) {
+	if isDir(oldName) && isDir(newName) {
+		oldFiles, e := listYbnFiles(oldName)
+		if e != nil {
+			return nil, "", e
+		}
+		newFiles, e := listYbnFiles(newName)
+		if e != nil {
+			return nil, "", e
+		}
+		base := func(files []string) (names []string) {
+			for _, f := range files {
+				names = append(names, filepath.Base(f))
+			}
+			return
+		}
+		guessProjectOps(append(oldFiles, newFiles...), key, guessKey, ops)
+		return diffFileSets(base(oldFiles), base(newFiles), func(name string, isNew bool) ([]byte, error) {
+			if isNew {
+				return os.ReadFile(filepath.Join(newName, name))
+			}
+			return os.ReadFile(filepath.Join(oldName, name))
+		}, key, guessKey, ops, codePage)
+	}
+	oldStm, err := os.ReadFile(oldName)
+	if err != nil {
+		return
+	}
+	newStm, err := os.ReadFile(newName)
+	if err != nil {
+		return
+	}
+	if ybnMagic(oldStm) == "YPF\x00" {
+		_, oldNames, oldFiles, e := listYpfFiles(oldStm, codePage)
+		if e != nil {
+			return nil, "", e
+		}
+		_, newNames, newFiles, e := listYpfFiles(newStm, codePage)
+		if e != nil {
+			return nil, "", e
+		}
+		return diffFileSets(oldNames, newNames, func(name string, isNew bool) ([]byte, error) {
+			if isNew {
+				return extractFileFromYpf(newStm, newFiles[name])
+			}
+			return extractFileFromYpf(oldStm, oldFiles[name])
+		}, key, guessKey, ops, codePage)
+	}
+	name := filepath.Base(newName)
+	changes, text, err = diffYbn(name, oldStm, newStm, key, guessKey, ops, codePage)
+	if text != "" {
+		text = "--- a/" + name + "\n+++ b/" + name + "\n" + text
+	}
+	return
+}
+
+// diffText renders the changes of files without a unified diff, one line per
+// change.
+func diffText(changes []diffChange, unified string) string {
+	out := ""
+	for _, c := range changes {
+		if strings.HasPrefix(c.Where, "inst ") {
+			continue
+		}
+		switch c.Kind {
+		case "added":
+			out += fmt.Sprintf("+ %s: %s\n", c.File, strings.TrimSpace(c.Where+" "+c.New))
+		case "removed":
+			out += fmt.Sprintf("- %s: %s\n", c.File, strings.TrimSpace(c.Where+" "+c.Old))
+		default:
+			out += fmt.Sprintf("~ %s: %s %s -> %s\n", c.File, c.Where, c.Old, c.New)
+		}
+	}
+	return out + unified
+}
+
+// diffFiles writes the differences between two versions as text, or as json
+// if outName ends with .json. Without outName the text is printed.
+func diffFiles(oldName, newName, outName string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	changes, unified, err := diffInputs(oldName, newName, key, guessKey, ops, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logf("%d changes\n", len(changes))
+	if strings.ToLower(filepath.Ext(outName)) == ".json" {
+		if changes == nil {
+			changes = []diffChange{}
+		}
+		out, err := json.MarshalIndent(changes, "", "\t")
+		if err != nil {
+			fmt.Println("error when marshalling json:", err)
+			return false
+		}
+		os.WriteFile(outName, out, os.ModePerm)
+		return true
+	}
+	out := diffText(changes, unified)
+	if outName == "" {
+		fmt.Print(out)
+		return true
+	}
+	os.WriteFile(outName, []byte(out), os.ModePerm)
+	return true
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMyersDiff(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", ""},
+		{"abc", "abc", "==="},
+		{"", "ab", "++"},
+		{"ab", "", "--"},
+		{"abc", "abd", "==-+"},
+		{"xabc", "abc", "-==="},
+		{"abcabba", "cbabac", "--=+==-=+"},
+	}
+	for _, tt := range tests {
+		a, b := strings.Split(tt.a, ""), strings.Split(tt.b, "")
+		edits := myersDiff(a, b)
+		kinds := ""
+		for _, e := range edits {
+			kinds += string(e.Kind)
+		}
+		if kinds != tt.want {
+			t.Errorf("myersDiff(%s, %s) = %s, want %s", tt.a, tt.b, kinds, tt.want)
+		}
+	}
+}
+
+// lcsLength is the reference for the length of a shortest edit script.
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else if cur[j] > prev[j+1] {
+				cur[j+1] = cur[j]
+			} else {
+				cur[j+1] = prev[j+1]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// TestMyersDiffRandom checks that the edit scripts rebuild both sequences and
+// are as short as possible.
+func TestMyersDiffRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	seq := func() []string {
+		s := make([]string, rnd.Intn(40))
+		for i := range s {
+			s[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		return s
+	}
+	for i := 0; i < 500; i++ {
+		a, b := seq(), seq()
+		edits := myersDiff(a, b)
+		var gotA, gotB []string
+		changed := 0
+		for _, e := range edits {
+			switch e.Kind {
+			case '=':
+				if a[e.A] != b[e.B] {
+					t.Fatalf("%v %v: %v matches different lines", a, b, e)
+				}
+				gotA, gotB = append(gotA, a[e.A]), append(gotB, b[e.B])
+			case '-':
+				gotA = append(gotA, a[e.A])
+				changed++
+			case '+':
+				gotB = append(gotB, b[e.B])
+				changed++
+			}
+		}
+		if strings.Join(gotA, " ") != strings.Join(a, " ") || strings.Join(gotB, " ") != strings.Join(b, " ") {
+			t.Fatalf("%v %v: edits %v don't rebuild the sequences", a, b, edits)
+		}
+		if want := len(a) + len(b) - 2*lcsLength(a, b); changed != want {
+			t.Fatalf("%v %v: %d changes, shortest has %d", a, b, changed, want)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := strings.Split("1 2 3 4 5 6 7 8 9 10 11 12", " ")
+	b := strings.Split("1 2 3 4 x 6 7 8 9 10 11 12 13", " ")
+	want := "@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n" +
+		"@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n"
+	if got := unifiedDiff(a, b, myersDiff(a, b)); got != want {
+		t.Errorf("unifiedDiff =\n%s\nwant\n%s", got, want)
+	}
+	if got := unifiedDiff(a, a, myersDiff(a, a)); got != "" {
+		t.Errorf("unifiedDiff of equal sequences = %q", got)
+	}
+}
+
+func TestDiffKeyed(t *testing.T) {
+	got := diffKeyed("f", map[string]string{"a": "1", "b": "2", "c": "3"}, map[string]string{"a": "1", "b": "x", "d": "4"})
+	want := []diffChange{
+		{"f", "changed", "b", "2", "x"},
+		{"f", "removed", "c", "3", ""},
+		{"f", "added", "d", "", "4"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffKeyed = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// textFunctionStat counts how a call function is used across a project.
+type textFunctionStat struct {
+	Name       string
+	Calls      int
+	StringArgs int
+	TextArgs   int
+	Example    string
+	Extracted  bool
+}
+
+// isSentenceLike tells whether an ASCII string literal looks like text for
+// the player rather than a name: several words with letters in them.
+func isSentenceLike(s string) bool {
+	words := strings.Fields(s)
+	if len(words) < 3 {
+		return false
+	}
+	letters := 0
+	for _, c := range s {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' {
+			letters++
+		}
+	}
+	return letters*2 > len(s)
+}
+
+// isTextLiteral tells whether a string literal with its quotes looks like
+// text: anything with non-ASCII characters or a sentence.
+func isTextLiteral(lit []byte) bool {
+	s := strings.Trim(string(lit), `"'`)
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return true
+		}
+	}
+	return isSentenceLike(s)
+}
+
+// countTextFunctions adds the calls of a script to stats.
+func countTextFunctions(script *ystbInfo, ops *[256]string, codePage int, stats map[string]*textFunctionStat) {
+	for _, inst := range script.Insts {
+		if ops[inst.Op] != "call" || len(inst.Args) < 1 {
+			continue
+		}
+		name := strings.ToLower(strings.Trim(string(inst.Args[0].Res.Res), `"`))
+		stat, ok := stats[name]
+		if !ok {
+			stat = &textFunctionStat{Name: name, Extracted: isFunctionToExtract(inst.Args[0].Res.Res)}
+			stats[name] = stat
+		}
+		stat.Calls++
+		for _, arg := range inst.Args[1:] {
+			if arg.Type != 3 || len(arg.Res.Res) == 0 {
+				continue
+			}
+			stat.StringArgs++
+			if isTextLiteral(arg.Res.Res) {
+				stat.TextArgs++
+				if stat.Example == "" {
+					stat.Example = decodeText(arg.Res.Res, codePage)
+				}
+			}
+		}
+	}
+}
+
+// discoverTextFunctions ranks the call functions of the scripts by how many
+// of their string arguments look like text. Only functions with text are
+// returned, the most likely first.
+func discoverTextFunctions(inputName string, key []byte, guessKey bool, ops *[256]string, codePage int) (ranked []*textFunctionStat, err error) {
+	files := []string{inputName}
+	if isDir(inputName) {
+		files, err = listYbnFiles(inputName)
+		if err != nil {
+			return
+		}
+		guessProjectOps(files, key, guessKey, ops)
+	}
+	stats := map[string]*textFunctionStat{}
+	for _, file := range files {
+		stm, e := os.ReadFile(file)
+		if e != nil {
+			return nil, e
+		}
+		if ybnMagic(stm) != "YSTB" {
+			continue
+		}
+		fileKey := key
+		if guessKey {
+			fileKey = guessYstbKey(stm)
+		}
+		script, e := parseYstb(stm, fileKey, "")
+		if e != nil {
+			return nil, fmt.Errorf("%s: %v", file, e)
+		}
+		if !guessYstbOp(&script, ops) {
+			return nil, fmt.Errorf("%s: can't guess the opcode", file)
+		}
+		countTextFunctions(&script, ops, codePage, stats)
+	}
+	return rankTextFunctions(stats), nil
+}
+
+// rankTextFunctions returns the functions with text, the most text arguments
+// first.
+func rankTextFunctions(stats map[string]*textFunctionStat) (ranked []*textFunctionStat) {
+	for _, stat := range stats {
+		if stat.TextArgs > 0 {
+			ranked = append(ranked, stat)
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].TextArgs != ranked[j].TextArgs {
+			return ranked[i].TextArgs > ranked[j].TextArgs
+		}
+		return ranked[i].Name < ranked[j].Name
+	})
+	return
+}
+
+// discoveredProfile returns the loaded profile with the ranked functions not
+// yet extracted added to its text functions.
+func discoveredProfile(ranked []*textFunctionStat) profileInfo {
+	profile := gProfile
+	profile.TextFunctions = append([]string(nil), gProfile.TextFunctions...)
+	for _, stat := range ranked {
+		if !stat.Extracted {
+			profile.TextFunctions = append(profile.TextFunctions, stat.Name)
+		}
+	}
+	return profile
+}
+
+// printTextFunctions lists the ranked functions and writes the ones not yet
+// extracted into a profile, if outProfileName is given.
+func printTextFunctions(inputName, outProfileName string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	ranked, err := discoverTextFunctions(inputName, key, guessKey, ops, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	fmt.Println("function\tcalls\tstring args\ttext args\textracted\texample")
+	for _, stat := range ranked {
+		extracted := "no"
+		if stat.Extracted {
+			extracted = "yes"
+		}
+		fmt.Printf("%s\t%d\t%d\t%d\t%s\t%s\n", stat.Name, stat.Calls, stat.StringArgs, stat.TextArgs, extracted, stat.Example)
+	}
+	if outProfileName != "" {
+		logln("writing profile:", outProfileName)
+		profile := discoveredProfile(ranked)
+		if err := writeProfile(outProfileName, &profile); err != nil {
+			fmt.Println(err)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/regomne/eutil/codec"
+	"reflect"
+	"testing"
+)
+
+func TestIsTextLiteral(t *testing.T) {
+	tests := []struct {
+		lit  string
+		want bool
+	}{
+		{`"はい"`, true},
+		{`"Where are you going?"`, true},
+		{`"Hello there"`, false},
+		{`"data/bgm/01.ogg"`, false},
+		{`"1 2 3 4"`, false},
+		{`"a b c"`, true},
+		{`""`, false},
+	}
+	for _, tt := range tests {
+		if got := isTextLiteral(encodeText(tt.lit, codec.C932)); got != tt.want {
+			t.Errorf("isTextLiteral(%s) = %v, want %v", tt.lit, got, tt.want)
+		}
+	}
+}
+
+// callInst is a call of function with string arguments.
+func callInst(function string, args ...string) ystbInstInfo {
+	inst := ystbInstInfo{Op: 11, Args: []ystbArgInfo{{Type: 3, Res: ystbResourceEntry{Res: []byte(`"` + function + `"`)}}}}
+	for _, a := range args {
+		inst.Args = append(inst.Args, ystbArgInfo{Type: 3, Res: ystbResourceEntry{Res: encodeText(`"`+a+`"`, codec.C932)}})
+	}
+	return inst
+}
+
+func TestRankTextFunctions(t *testing.T) {
+	var ops [256]string
+	ops[10], ops[11] = "msg", "call"
+	script := ystbInfo{Insts: []ystbInstInfo{
+		callInst("es.msg.log", "こんにちは"),
+		callInst("ES.MSG.LOG", "さようなら", "bg01"),
+		callInst("es.sel.set", "はい", "いいえ"),
+		callInst("es.snd.play", "se/click.ogg"),
+		callInst("es.note", "One more thing here"),
+		{Op: 10, Args: []ystbArgInfo{{Type: 3, Res: ystbResourceEntry{Res: encodeText(`"本文"`, codec.C932)}}}},
+	}}
+	stats := map[string]*textFunctionStat{}
+	countTextFunctions(&script, &ops, codec.C932, stats)
+	if stat := stats["es.msg.log"]; stat == nil || stat.Calls != 2 || stat.StringArgs != 3 || stat.TextArgs != 2 || stat.Example != `"こんにちは"` {
+		t.Errorf("es.msg.log = %+v", stat)
+	}
+	if stat := stats["es.snd.play"]; stat == nil || stat.Calls != 1 || stat.TextArgs != 0 {
+		t.Errorf("es.snd.play = %+v", stat)
+	}
+	var got []string
+	for _, stat := range rankTextFunctions(stats) {
+		got = append(got, stat.Name)
+	}
+	want := []string{"es.msg.log", "es.sel.set", "es.note"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rankTextFunctions = %v, want %v", got, want)
+	}
+	if !stats["es.sel.set"].Extracted || stats["es.msg.log"].Extracted {
+		t.Errorf("extracted: es.sel.set %v, es.msg.log %v", stats["es.sel.set"].Extracted, stats["es.msg.log"].Extracted)
+	}
+}
+
+func TestDiscoveredProfile(t *testing.T) {
+	saved := gProfile
+	defer func() { gProfile = saved }()
+	// room left in the slice must not be written by the discovered profile
+	gProfile = profileInfo{TextFunctions: make([]string, 1, 4), AllStrings: true}
+	gProfile.TextFunctions[0] = "es.known"
+	ranked := []*textFunctionStat{
+		{Name: "es.msg.log", TextArgs: 3},
+		{Name: "es.sel.set", TextArgs: 2, Extracted: true},
+		{Name: "es.note", TextArgs: 1},
+	}
+	profile := discoveredProfile(ranked)
+	want := profileInfo{TextFunctions: []string{"es.known", "es.msg.log", "es.note"}, AllStrings: true}
+	if !reflect.DeepEqual(profile, want) {
+		t.Errorf("discoveredProfile = %+v, want %+v", profile, want)
+	}
+	if extra := gProfile.TextFunctions[:2]; extra[1] != "" {
+		t.Errorf("the loaded profile was changed: %v", extra)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// exprToken is one token of the postfix byte code of an expression argument:
+// a type byte, a 16-bit length and the data. Operators have no data.
+type exprToken struct {
+	Kind byte
+	Data []byte
+}
+
+// exprOperators are the infix forms of the operator tokens.
+var exprOperators = map[byte]string{
+	'=': "==", '!': "!=", '<': "<", '>': ">", '{': "<=", '}': ">=",
+	'+': "+", '-': "-", '*': "*", '/': "/", '%': "%",
+	'&': "&", '|': "|", '^': "^", 'A': "&&", 'O': "||",
+}
+
+// ystbArgExpr returns the byte code of an expression argument as it is
+// stored in the resource section.
+func ystbArgExpr(arg *ystbArgInfo) []byte {
+	if len(arg.Res.ResRaw) != 0 {
+		return arg.Res.ResRaw
+	}
+	if arg.Res.Type == 0 && len(arg.Res.Res) == 0 {
+		return nil
+	}
+	expr := []byte{arg.Res.Type, 0, 0}
+	binary.LittleEndian.PutUint16(expr[1:], uint16(len(arg.Res.Res)))
+	return append(expr, arg.Res.Res...)
+}
+
+func parseExpr(code []byte) (tokens []exprToken, err error) {
+	for len(code) > 0 {
+		if len(code) < 3 {
+			return nil, fmt.Errorf("expression truncated")
+		}
+		n := int(binary.LittleEndian.Uint16(code[1:]))
+		if len(code) < 3+n {
+			return nil, fmt.Errorf("expression token 0x%02X exceeds the expression", code[0])
+		}
+		tokens = append(tokens, exprToken{code[0], code[3 : 3+n]})
+		code = code[3+n:]
+	}
+	return
+}
+
+func (t *exprToken) isOperator() bool {
+	return len(t.Data) == 0
+}
+
+// intValue returns the value of an integer literal.
+func (t *exprToken) intValue() (int64, bool) {
+	switch {
+	case t.Kind == 'B' && len(t.Data) == 1:
+		return int64(int8(t.Data[0])), true
+	case t.Kind == 'W' && len(t.Data) == 2:
+		return int64(int16(binary.LittleEndian.Uint16(t.Data))), true
+	case t.Kind == 'I' && len(t.Data) == 4:
+		return int64(int32(binary.LittleEndian.Uint32(t.Data))), true
+	case t.Kind == 'L' && len(t.Data) == 8:
+		return int64(binary.LittleEndian.Uint64(t.Data)), true
+	}
+	return 0, false
+}
+
+// variable returns the name of a variable reference like @12, or "".
+func (t *exprToken) variable() string {
+	if t.Kind != 'H' || len(t.Data) != 3 {
+		return ""
+	}
+	return string(t.Data[:1]) + strconv.Itoa(int(binary.LittleEndian.Uint16(t.Data[1:])))
+}
+
+// varIndex returns the index of a variable reference.
+func (t *exprToken) varIndex() (uint16, bool) {
+	if t.variable() == "" {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint16(t.Data[1:]), true
+}
+
+func (t *exprToken) format(codePage int) string {
+	if v, ok := t.intValue(); ok {
+		return strconv.FormatInt(v, 10)
+	}
+	if v := t.variable(); v != "" {
+		return v
+	}
+	switch {
+	case t.Kind == 'F' && len(t.Data) == 8:
+		return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(t.Data)), 'g', -1, 64)
+	case t.Kind == 'M':
+		return decodeText(t.Data, codePage)
+	case t.isOperator():
+		if op, ok := exprOperators[t.Kind]; ok {
+			return op
+		}
+		return string(t.Kind)
+	}
+	return fmt.Sprintf("%c{%X}", t.Kind, t.Data)
+}
+
+// formatExpr renders postfix tokens in infix notation, like @1 == 2. Code
+// that doesn't evaluate to one value is listed token by token.
+func formatExpr(tokens []exprToken, codePage int) string {
+	type operand struct {
+		Text     string
+		Compound bool
+	}
+	var stack []operand
+	for i := range tokens {
+		t := &tokens[i]
+		if !t.isOperator() {
+			stack = append(stack, operand{t.format(codePage), false})
+			continue
+		}
+		if len(stack) < 2 {
+			stack = nil
+			break
+		}
+		sides := stack[len(stack)-2:]
+		for j := range sides {
+			if sides[j].Compound {
+				sides[j].Text = "(" + sides[j].Text + ")"
+			}
+		}
+		stack = append(stack[:len(stack)-2], operand{sides[0].Text + " " + t.format(codePage) + " " + sides[1].Text, true})
+	}
+	if len(stack) != 1 {
+		parts := make([]string, len(tokens))
+		for i := range tokens {
+			parts[i] = tokens[i].format(codePage)
+		}
+		return strings.Join(parts, " ")
+	}
+	return stack[0].Text
+}
+
+// exprComparison matches an expression of the form variable == number.
+func exprComparison(tokens []exprToken) (variable string, value int64, ok bool) {
+	if len(tokens) != 3 || tokens[2].Kind != '=' || !tokens[2].isOperator() {
+		return
+	}
+	a, b := &tokens[0], &tokens[1]
+	if a.variable() == "" {
+		a, b = b, a
+	}
+	variable = a.variable()
+	value, ok = b.intValue()
+	return variable, value, ok && variable != ""
+}
+
+// argLabel returns the label an argument of a jump refers to: a string like
+// "#NAME", or the id of a label of the project.
+func argLabel(arg *ystbArgInfo, project *projectInfo, codePage int) string {
+	if arg.Type == 3 {
+		return strings.TrimPrefix(strings.Trim(decodeText(arg.Res.Res, codePage), `"'`), "#")
+	}
+	tokens, err := parseExpr(ystbArgExpr(arg))
+	if err != nil || len(tokens) != 1 {
+		return ""
+	}
+	if tokens[0].Kind == 'M' {
+		return strings.TrimPrefix(strings.Trim(decodeText(tokens[0].Data, codePage), `"'`), "#")
+	}
+	id, ok := tokens[0].intValue()
+	if !ok || project == nil {
+		return ""
+	}
+	return project.labelName(uint32(id))
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// routeNode is a label, or the start of a script without a label there.
+type routeNode struct {
+	Id       string
+	Script   string `json:",omitempty"`
+	Source   string `json:",omitempty"`
+	Inst     int
+	Messages int    // messages until the next label
+	Text     string `json:",omitempty"` // the first message, for context
+}
+
+type routeEdge struct {
+	From, To  string
+	Kind      string // choice, jump, gosub or next for falling through to a label
+	Text      string `json:",omitempty"` // the option of a choice
+	Condition string `json:",omitempty"`
+	At        string // script:instruction
+}
+
+// routeEdgeKey is what makes an edge distinct, the place it is found at
+// doesn't.
+type routeEdgeKey struct {
+	From, To, Kind, Text string
+}
+
+type routeGraph struct {
+	Nodes []*routeNode
+	Edges []routeEdge
+	nodes map[string]*routeNode
+	edges map[routeEdgeKey]bool
+}
+
+func (g *routeGraph) node(id string) *routeNode {
+	if n, ok := g.nodes[id]; ok {
+		return n
+	}
+	n := &routeNode{Id: id}
+	g.nodes[id] = n
+	g.Nodes = append(g.Nodes, n)
+	return n
+}
+
+func (g *routeGraph) addEdge(e routeEdge) {
+	key := routeEdgeKey{e.From, e.To, e.Kind, e.Text}
+	if g.edges[key] {
+		return
+	}
+	g.edges[key] = true
+	g.Edges = append(g.Edges, e)
+}
+
+// addYstbRoutes adds the labels of a script as nodes and its jumps, gosubs
+// and menu branches as edges.
+func (g *routeGraph) addYstbRoutes(script *ystbInfo, name string, ops *[256]string, codePage int, project *projectInfo) error {
+	menus, err := ystbChoiceMenus(script, name, ops, codePage, project)
+	if err != nil {
+		return err
+	}
+	branches := map[int]bool{}
+	for _, menu := range menus {
+		from := g.nodeAt(script, name, project, menu.lastInst)
+		for _, o := range menu.Options {
+			if o.Target == "" {
+				continue
+			}
+			branches[o.branchInst] = true
+			g.addEdge(routeEdge{
+				From:      from.Id,
+				To:        g.node(o.Target).Id,
+				Kind:      "choice",
+				Text:      strings.Trim(o.Text, `"'`),
+				Condition: o.Condition,
+				At:        fmt.Sprintf("%s:%d", name, o.branchInst),
+			})
+		}
+	}
+	var cur *routeNode
+	ended := false
+	for i := range script.Insts {
+		inst := &script.Insts[i]
+		n := g.nodeAt(script, name, project, i)
+		if n != cur {
+			if cur != nil && !ended {
+				g.addEdge(routeEdge{From: cur.Id, To: n.Id, Kind: "next", At: fmt.Sprintf("%s:%d", name, i)})
+			}
+			cur = n
+		}
+		if ops[inst.Op] == "msg" {
+			if cur.Messages == 0 {
+				cur.Text = decodeText(ystbRefBytes(script, ystbTextRef{i, 0}), codePage)
+			}
+			cur.Messages++
+		}
+		cmd := project.commandName(inst.Op)
+		ended = cmd == "JUMP" || cmd == "RETURN" || cmd == "END"
+		if (cmd == "JUMP" || cmd == "GOSUB") && len(inst.Args) > 0 && !branches[i] {
+			if target := argLabel(&inst.Args[0], project, codePage); target != "" {
+				g.addEdge(routeEdge{From: cur.Id, To: g.node(target).Id, Kind: strings.ToLower(cmd), At: fmt.Sprintf("%s:%d", name, i)})
+			}
+		}
+	}
+	return nil
+}
+
+// nodeAt returns the node of the label an instruction is under.
+func (g *routeGraph) nodeAt(script *ystbInfo, name string, project *projectInfo, inst int) *routeNode {
+	id := name
+	at := 0
+	if scriptId, ok := scriptIdOfName(name); ok {
+		for _, label := range project.Labels[scriptId] {
+			if int(label.CommandIndex) > inst {
+				break
+			}
+			id, at = label.Name, int(label.CommandIndex)
+		}
+		n := g.node(id)
+		n.Script, n.Inst, n.Source = name, at, project.sourceOf(scriptId)
+		return n
+	}
+	n := g.node(id)
+	n.Script = name
+	return n
+}
+
+// buildRouteGraph reads the scripts of a game directory into a graph of its
+// labels.
+func buildRouteGraph(inputName string, key []byte, guessKey bool, ops *[256]string, codePage int) (graph *routeGraph, err error) {
+	files := []string{inputName}
+	dir := filepath.Dir(inputName)
+	if isDir(inputName) {
+		files, err = listYbnFiles(inputName)
+		if err != nil {
+			return
+		}
+		dir = inputName
+		guessProjectOps(files, key, guessKey, ops)
+	}
+	project := loadProject(dir, codePage)
+	if len(project.Commands) == 0 {
+		fmt.Println("no ysc.ybn found, jumps and branches are unknown")
+	}
+	graph = &routeGraph{nodes: map[string]*routeNode{}, edges: map[routeEdgeKey]bool{}}
+	for _, file := range files {
+		stm, e := os.ReadFile(file)
+		if e != nil {
+			return nil, e
+		}
+		if ybnMagic(stm) != "YSTB" {
+			continue
+		}
+		fileKey := key
+		if guessKey {
+			fileKey = guessYstbKey(stm)
+		}
+		script, e := parseYstb(stm, fileKey, "")
+		if e != nil {
+			return nil, fmt.Errorf("%s: %v", file, e)
+		}
+		if !guessYstbOp(&script, ops) {
+			return nil, fmt.Errorf("%s: can't guess the opcode", file)
+		}
+		if e := graph.addYstbRoutes(&script, scriptName(file), ops, codePage, project); e != nil {
+			return nil, fmt.Errorf("%s: %v", file, e)
+		}
+	}
+	return
+}
+
+// dotQuote quotes s as a DOT string.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+var routeEdgeStyles = map[string]string{
+	"choice": "bold",
+	"jump":   "solid",
+	"gosub":  "dashed",
+	"next":   "dotted",
+}
+
+// writeDot writes the graph for Graphviz, with the labels of a script in a
+// cluster.
+func (g *routeGraph) writeDot(fileName string) error {
+	var sb strings.Builder
+	sb.WriteString("digraph route {\n\tnode [shape=box];\n")
+	var scripts []string
+	byScript := map[string][]*routeNode{}
+	for _, n := range g.Nodes {
+		if _, ok := byScript[n.Script]; !ok {
+			scripts = append(scripts, n.Script)
+		}
+		byScript[n.Script] = append(byScript[n.Script], n)
+	}
+	for i, script := range scripts {
+		indent := "\t"
+		if script != "" {
+			title := script
+			if src := byScript[script][0].Source; src != "" {
+				title = src
+			}
+			fmt.Fprintf(&sb, "\tsubgraph cluster_%d {\n\t\tlabel=%s;\n", i, dotQuote(title))
+			indent = "\t\t"
+		}
+		for _, n := range byScript[script] {
+			label := n.Id
+			if n.Script != "" {
+				label += "\n" + strconv.Itoa(n.Messages) + " messages"
+			}
+			if n.Text != "" {
+				label += "\n" + n.Text
+			}
+			fmt.Fprintf(&sb, "%s%s [label=%s];\n", indent, dotQuote(n.Id), dotQuote(label))
+		}
+		if script != "" {
+			sb.WriteString("\t}\n")
+		}
+	}
+	for _, e := range g.Edges {
+		attrs := "style=" + routeEdgeStyles[e.Kind]
+		if e.Kind == "choice" {
+			attrs += ", label=" + dotQuote(e.Text)
+		}
+		fmt.Fprintf(&sb, "\t%s -> %s [%s];\n", dotQuote(e.From), dotQuote(e.To), attrs)
+	}
+	sb.WriteString("}\n")
+	return os.WriteFile(fileName, []byte(sb.String()), os.ModePerm)
+}
+
+// writeRouteGraph builds the route graph of a game and writes it as DOT or
+// json depending on the extension of outName.
+func writeRouteGraph(inputName, outName string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	graph, err := buildRouteGraph(inputName, key, guessKey, ops, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logf("%d nodes, %d edges\n", len(graph.Nodes), len(graph.Edges))
+	logln("writing:", outName)
+	switch strings.ToLower(filepath.Ext(outName)) {
+	case ".dot", ".gv":
+		err = graph.writeDot(outName)
+	case ".json":
+		var out []byte
+		if out, err = json.MarshalIndent(graph, "", "\t"); err != nil {
+			fmt.Println("error when marshalling json:", err)
+			return false
+		}
+		err = os.WriteFile(outName, out, os.ModePerm)
+	default:
+		err = fmt.Errorf("unknown graph file type: %s", outName)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logln("complete.")
+	return true
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRouteGraphAddEdge(t *testing.T) {
+	g := &routeGraph{nodes: map[string]*routeNode{}, edges: map[routeEdgeKey]bool{}}
+	edges := []routeEdge{
+		{From: "a", To: "b", Kind: "jump", At: "yst00000:3"},
+		{From: "a", To: "b", Kind: "jump", At: "yst00000:9"},
+		{From: "a", To: "b", Kind: "gosub", At: "yst00000:12"},
+		{From: "a", To: "b", Kind: "choice", Text: "はい", At: "yst00000:20"},
+		{From: "a", To: "b", Kind: "choice", Text: "いいえ", At: "yst00000:20"},
+		{From: "b", To: "a", Kind: "jump", At: "yst00001:0"},
+	}
+	for _, e := range edges {
+		g.addEdge(e)
+	}
+	want := append(edges[:1:1], edges[2:]...)
+	if !reflect.DeepEqual(g.Edges, want) {
+		t.Errorf("edges = %+v, want %+v", g.Edges, want)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	numberLiteralRegex = regexp.MustCompile(`^(?:[-+]?[0-9][0-9.,:%/ ]*|#[0-9A-Fa-f]+|0[xX][0-9A-Fa-f]+)$`)
+	// ASCII file names with a known extension, or ASCII names joined by path
+	// separators
+	assetLiteralRegex = regexp.MustCompile(`(?i)^(?:[A-Za-z0-9_.@$#-]+[/\\])*[A-Za-z0-9_@$#-][A-Za-z0-9_.@$#-]*\.(?:avi|bmp|csv|dat|gif|ico|ini|jpe?g|json|mid|mp3|mp4|mpg|ogg|ogv|opus|png|tga|ttf|otf|txt|wav|webm|webp|wma|wmv|xml|ybn|ypf|yst)$|^[A-Za-z0-9_.@$#-]*(?:[/\\][A-Za-z0-9_.@$#-]+)+[/\\]?$`)
+	// ASCII names with something no word has: _ @ $ # or a digit, a . or :
+	// inside or an inner capital like saveData, so Yes, OK or Wait. stay text
+	identifierLiteralRegex = regexp.MustCompile(`^[A-Za-z_@$#][A-Za-z0-9_.@$#:-]*$`)
+	identifierMarkRegex    = regexp.MustCompile(`[_@$#0-9]|[A-Za-z0-9][.:][A-Za-z0-9]|[a-z][A-Z]`)
+)
+
+// classifyLiteral sorts a string argument into translatable, asset (a file
+// name or path), identifier or number.
+func classifyLiteral(text string) string {
+	s := strings.Trim(text, `"'`)
+	switch {
+	case s == "":
+		return "identifier"
+	case numberLiteralRegex.MatchString(s):
+		return "number"
+	case assetLiteralRegex.MatchString(s):
+		return "asset"
+	case identifierLiteralRegex.MatchString(s) && identifierMarkRegex.MatchString(s):
+		return "identifier"
+	}
+	return "translatable"
+}
+
+// isTranslatableLiteral decides whether a string argument of a call is
+// extracted. The deny and allow rules of the profile come first, then all
+// arguments of text functions are, and with AllStrings every argument that
+// classifies as translatable.
+func isTranslatableLiteral(function, text string, textFunction bool) bool {
+	for i := range gProfile.Deny {
+		if gProfile.Deny[i].matches(function, text) {
+			return false
+		}
+	}
+	for i := range gProfile.Allow {
+		if gProfile.Allow[i].matches(function, text) {
+			return true
+		}
+	}
+	if textFunction {
+		return true
+	}
+	class := classifyLiteral(text)
+	if class != "translatable" {
+		logf("skipping %s argument of %s: %s\n", class, function, text)
+	}
+	return class == "translatable"
+}
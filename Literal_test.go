@@ -0,0 +1,80 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestClassifyLiteral(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{`""`, "identifier"},
+		{`"123"`, "number"},
+		{`"-1.5"`, "number"},
+		{`"10:30"`, "number"},
+		{`"#FF00FF"`, "number"},
+		{`"0x1F"`, "number"},
+		{`"bg01.png"`, "asset"},
+		{`"BGM.OGG"`, "asset"},
+		{`"data/bgm/01"`, "asset"},
+		{`"se\click.wav"`, "asset"},
+		{`"cg\ev01\"`, "asset"},
+		{`"はい/いいえ"`, "translatable"},
+		{`"画像.png"`, "translatable"},
+		{`"Yes"`, "translatable"},
+		{`"Save"`, "translatable"},
+		{`"OK"`, "translatable"},
+		{`"Wait."`, "translatable"},
+		{`"Mr.Smith is here"`, "translatable"},
+		{`"v1.0"`, "identifier"},
+		{`"es.msg.log"`, "identifier"},
+		{`"flag_01"`, "identifier"},
+		{`"bgm01"`, "identifier"},
+		{`"saveData"`, "identifier"},
+		{`"@name"`, "identifier"},
+		{`"$hp"`, "identifier"},
+		{`"こんにちは"`, "translatable"},
+		{`"Good morning!"`, "translatable"},
+	}
+	for _, tt := range tests {
+		if got := classifyLiteral(tt.text); got != tt.want {
+			t.Errorf("classifyLiteral(%s) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestIsTranslatableLiteral(t *testing.T) {
+	saved := gProfile
+	defer func() { gProfile = saved }()
+	gProfile = profileInfo{
+		Allow: []literalRule{
+			{Function: "sys.title"},
+			{Text: `^"@`, text: regexp.MustCompile(`^"@`)},
+		},
+		Deny: []literalRule{
+			{Function: "es.file.*"},
+			{Function: "sys.title", Text: `debug`, text: regexp.MustCompile(`debug`)},
+		},
+	}
+	tests := []struct {
+		function, text string
+		textFunction   bool
+		want           bool
+	}{
+		{"es.ui.set", `"Yes"`, false, true},
+		{"es.ui.set", `"bg01.png"`, false, false},
+		{"es.ui.set", `"bg01.png"`, true, true},
+		{"es.file.load", `"はい"`, true, false},
+		{"es.file.load", `"はい"`, false, false},
+		{"sys.title", `"game_title"`, false, true},
+		{"sys.title", `"debug mode"`, false, false},
+		{"es.ui.set", `"@name"`, false, true},
+		{"es.file.read", `"@name"`, false, false},
+	}
+	for _, tt := range tests {
+		if got := isTranslatableLiteral(tt.function, tt.text, tt.textFunction); got != tt.want {
+			t.Errorf("isTranslatableLiteral(%s, %s, %v) = %v, want %v", tt.function, tt.text, tt.textFunction, got, tt.want)
+		}
+	}
+}
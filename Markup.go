@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// markupToken is a piece of message text. Everything but "text" is a control
+// sequence the engine interprets and must survive translation.
+type markupToken struct {
+	Kind string // text, byte, ruby, wait, color, tag, var, broken
+	Text string
+}
+
+// markupRegex matches the inline control sequences of message text:
+// tags like <RUBY text=...>, </RUBY>, <WAIT 500> or <COLOR 255,0,0> and
+// variables like @flag, $name or $$name(1). A lone < is malformed. Byte
+// escapes like \x{81AD} are text, but must not be split.
+var markupRegex = regexp.MustCompile(`\\x\{(?:[0-9A-Fa-f]{2})+\}|<[^<>]*>|<|(?:@@?|\$\$?)[A-Za-z_][A-Za-z0-9_]*(?:\([0-9A-Za-z_@$,]*\))?`)
+
+func markupTagKind(tag string) string {
+	name := strings.TrimPrefix(strings.Trim(tag, "<>"), "/")
+	if i := strings.IndexAny(name, " \t=:"); i >= 0 {
+		name = name[:i]
+	}
+	switch strings.ToLower(name) {
+	case "ruby", "r":
+		return "ruby"
+	case "wait", "w":
+		return "wait"
+	case "color", "col", "c":
+		return "color"
+	}
+	return "tag"
+}
+
+// tokenizeMessage splits message text into text and control sequences.
+func tokenizeMessage(s string) []markupToken {
+	var tokens []markupToken
+	pos := 0
+	for _, m := range markupRegex.FindAllStringIndex(s, -1) {
+		if m[0] > pos {
+			tokens = append(tokens, markupToken{"text", s[pos:m[0]]})
+		}
+		text := s[m[0]:m[1]]
+		switch {
+		case byteEscapeRegex.MatchString(text):
+			tokens = append(tokens, markupToken{"byte", text})
+		case text == "<":
+			tokens = append(tokens, markupToken{"broken", text})
+		case text[0] == '<':
+			tokens = append(tokens, markupToken{markupTagKind(text), text})
+		default:
+			tokens = append(tokens, markupToken{"var", text})
+		}
+		pos = m[1]
+	}
+	if pos < len(s) {
+		tokens = append(tokens, markupToken{"text", s[pos:]})
+	}
+	return tokens
+}
+
+// markupSignature identifies a control sequence for comparison. The reading
+// of ruby is translated along with the text, so only the tag name counts.
+func markupSignature(t markupToken) string {
+	if t.Kind == "ruby" {
+		if strings.HasPrefix(t.Text, "</") {
+			return "</ruby>"
+		}
+		return "<ruby>"
+	}
+	return t.Text
+}
+
+// markupNesting is 1 for opening tags that need a closing one, -1 for closing
+// tags and 0 for everything else.
+func markupNesting(t markupToken) int {
+	switch {
+	case strings.HasPrefix(t.Text, "</"):
+		return -1
+	case t.Kind == "ruby" || t.Kind == "color":
+		return 1
+	}
+	return 0
+}
+
+// checkMarkup compares the control sequences of a translation with those of
+// the original and describes everything missing, added or malformed.
+func checkMarkup(original, translated string) (problems []string) {
+	counts := map[string]int{}
+	balance := map[string]int{}
+	for _, t := range tokenizeMessage(original) {
+		if t.Kind != "text" && t.Kind != "byte" && t.Kind != "broken" {
+			counts[markupSignature(t)]++
+			balance[t.Kind] += markupNesting(t)
+		}
+	}
+	for _, t := range tokenizeMessage(translated) {
+		switch t.Kind {
+		case "text", "byte":
+			continue
+		case "broken":
+			problems = append(problems, "malformed control sequence starting with "+t.Text)
+			continue
+		}
+		counts[markupSignature(t)]--
+		balance[t.Kind] -= markupNesting(t)
+	}
+	var keys []string
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if counts[k] > 0 {
+			problems = append(problems, fmt.Sprintf("missing %s", k))
+		} else if counts[k] < 0 {
+			problems = append(problems, fmt.Sprintf("unexpected %s", k))
+		}
+	}
+	for _, kind := range []string{"ruby", "color", "tag"} {
+		if balance[kind] != 0 {
+			problems = append(problems, fmt.Sprintf("unbalanced %s tags", kind))
+		}
+	}
+	return
+}
+
+// reportMarkup prints the control sequence problems of a translated line.
+func reportMarkup(id, original, translated string) {
+	if original == translated {
+		return
+	}
+	for _, problem := range checkMarkup(original, translated) {
+		fmt.Printf("warning: %s: %s\n", id, problem)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenizeMessage(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []markupToken
+	}{
+		{"", nil},
+		{"plain", []markupToken{{"text", "plain"}}},
+		{"<RUBY text=かんじ>漢字</RUBY>!", []markupToken{{"ruby", "<RUBY text=かんじ>"}, {"text", "漢字"}, {"ruby", "</RUBY>"}, {"text", "!"}}},
+		{"a<WAIT 500>b<w>", []markupToken{{"text", "a"}, {"wait", "<WAIT 500>"}, {"text", "b"}, {"wait", "<w>"}}},
+		{"<COLOR 255,0,0>x</COL>", []markupToken{{"color", "<COLOR 255,0,0>"}, {"text", "x"}, {"color", "</COL>"}}},
+		{"<FONT size=2>", []markupToken{{"tag", "<FONT size=2>"}}},
+		{"hi @flag and $name, $$f(1,@a)", []markupToken{{"text", "hi "}, {"var", "@flag"}, {"text", " and "}, {"var", "$name"}, {"text", ", "}, {"var", "$$f(1,@a)"}}},
+		{"a < b", []markupToken{{"text", "a "}, {"broken", "<"}, {"text", " b"}}},
+		{"\\x{81AD}x", []markupToken{{"byte", "\\x{81AD}"}, {"text", "x"}}},
+		{"mail@ 1", []markupToken{{"text", "mail@ 1"}}},
+	}
+	for _, tt := range tests {
+		if got := tokenizeMessage(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenizeMessage(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestCheckMarkup(t *testing.T) {
+	tests := []struct {
+		original, translated string
+		want                 []string
+	}{
+		{"plain", "anders", nil},
+		{"<RUBY text=かんじ>漢字</RUBY>", "<RUBY text=kanji>Kanji</RUBY>", nil},
+		{"a<WAIT 500>b", "ab", []string{"missing <WAIT 500>"}},
+		{"a<WAIT 500>b", "a<WAIT 300>b", []string{"unexpected <WAIT 300>", "missing <WAIT 500>"}},
+		{"@name says", "says", []string{"missing @name"}},
+		{"hi", "hi $name", []string{"unexpected $name"}},
+		{"<COLOR 1>x</COLOR>", "<COLOR 1>x", []string{"missing </COLOR>", "unbalanced color tags"}},
+		{"x", "a < b", []string{"malformed control sequence starting with <"}},
+		{"\\x{81AD}", "", nil},
+		{"a < b", "a b", nil},
+	}
+	for _, tt := range tests {
+		if got := checkMarkup(tt.original, tt.translated); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("checkMarkup(%q, %q) = %q, want %q", tt.original, tt.translated, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// menuScanLimit is how many instructions after a menu are searched for the
+// branches on its result.
+const menuScanLimit = 64
+
+type choiceOption struct {
+	Id          string // id of the string entry
+	Text        string
+	Translation string `json:",omitempty"`
+	Condition   string `json:",omitempty"` // like @1 == 2
+	Target      string `json:",omitempty"` // label jumped to
+	branchInst  int    // the JUMP or GOSUB
+}
+
+// choiceMenu is the options set by consecutive es.sel.* calls, shown to the
+// player as one menu.
+type choiceMenu struct {
+	Id       string // script:instruction of the first option
+	Script   string
+	Label    string `json:",omitempty"`
+	Source   string `json:",omitempty"`
+	Variable string `json:",omitempty"` // variable the choice is compared with
+	Options  []choiceOption
+	lastInst int
+	base     int64 // value of Variable for the first option
+}
+
+func isChoiceCall(inst *ystbInstInfo, ops *[256]string) bool {
+	return ops[inst.Op] == "call" && len(inst.Args) > 0 &&
+		strings.HasPrefix(strings.ToLower(strings.Trim(string(inst.Args[0].Res.Res), `"`)), "es.sel.")
+}
+
+// menuEntryId is the id of the entry holding all options of a menu.
+func menuEntryId(menuId string) string {
+	return menuId + ":menu"
+}
+
+// ystbChoiceMenus groups the choice strings of a script into menus. With the
+// command names of the project the IF ... JUMP/GOSUB branches following a
+// menu give the label each option leads to.
+func ystbChoiceMenus(script *ystbInfo, name string, ops *[256]string, codePage int, project *projectInfo) (menus []choiceMenu, err error) {
+	refs, err := ystbTextRefs(script, ops, codePage)
+	if err != nil {
+		return
+	}
+	entries, err := ystbTextEntries(script, name, ops, codePage, project)
+	if err != nil {
+		return
+	}
+	for i, e := range entries {
+		if e.Kind != "choice" {
+			continue
+		}
+		inst := refs[i].Inst
+		if n := len(menus); n == 0 || !isMenuContinued(script, ops, menus[n-1].lastInst, inst) {
+			menus = append(menus, choiceMenu{
+				Id:     fmt.Sprintf("%s:%d", name, inst),
+				Script: name,
+				Label:  e.Label,
+				Source: e.Source,
+			})
+		}
+		menu := &menus[len(menus)-1]
+		menu.Options = append(menu.Options, choiceOption{Id: e.Id, Text: e.Text})
+		menu.lastInst = inst
+	}
+	for i := range menus {
+		findMenuBranches(script, ops, codePage, project, &menus[i])
+	}
+	return
+}
+
+// isMenuContinued tells whether the option at inst belongs to the menu ending
+// at last: only other es.sel.* calls may lie between them.
+func isMenuContinued(script *ystbInfo, ops *[256]string, last, inst int) bool {
+	for i := last + 1; i < inst; i++ {
+		if !isChoiceCall(&script.Insts[i], ops) {
+			return false
+		}
+	}
+	return true
+}
+
+// findMenuBranches looks for IF variable == n followed by a JUMP or GOSUB
+// after the menu and takes the label as the target of option n. Values
+// start at 1 unless one of them is 0.
+func findMenuBranches(script *ystbInfo, ops *[256]string, codePage int, project *projectInfo, menu *choiceMenu) {
+	type branch struct {
+		Value     int64
+		Condition string
+		Target    string
+		Inst      int
+	}
+	var branches []branch
+	var pending *branch
+	shown := false
+scan:
+	for i := menu.lastInst + 1; i < len(script.Insts) && i <= menu.lastInst+menuScanLimit; i++ {
+		inst := &script.Insts[i]
+		if isChoiceCall(inst, ops) {
+			if shown {
+				break // the next menu
+			}
+			continue
+		}
+		shown = true
+		switch project.commandName(inst.Op) {
+		case "IF":
+			pending = nil
+			if len(inst.Args) == 0 {
+				continue
+			}
+			tokens, err := parseExpr(ystbArgExpr(&inst.Args[0]))
+			if err != nil {
+				continue
+			}
+			variable, value, ok := exprComparison(tokens)
+			if !ok || menu.Variable != "" && menu.Variable != variable {
+				continue
+			}
+			menu.Variable = variable
+			pending = &branch{Value: value, Condition: formatExpr(tokens, codePage)}
+		case "JUMP", "GOSUB":
+			if pending != nil && len(inst.Args) > 0 {
+				pending.Target = argLabel(&inst.Args[0], project, codePage)
+				pending.Inst = i
+				branches = append(branches, *pending)
+				pending = nil
+			}
+		case "ELSE", "IFEND":
+			pending = nil
+		case "RETURN", "END":
+			break scan
+		}
+		if ops[inst.Op] == "msg" {
+			break
+		}
+	}
+	menu.base = 1
+	for _, b := range branches {
+		if b.Value == 0 {
+			menu.base = 0
+		}
+	}
+	for _, b := range branches {
+		if k := b.Value - menu.base; k >= 0 && k < int64(len(menu.Options)) {
+			menu.Options[k].Condition = b.Condition
+			menu.Options[k].Target = b.Target
+			menu.Options[k].branchInst = b.Inst
+		}
+	}
+}
+
+// menuNotes describes where the options of a menu lead, for translators.
+func menuNotes(menu *choiceMenu) (notes []string) {
+	for i, o := range menu.Options {
+		if o.Target == "" {
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("option %d: %s -> %s", i+1, o.Condition, o.Target))
+	}
+	return
+}
+
+// groupMenuEntries replaces the option strings of every menu by one entry
+// with an option per line.
+func groupMenuEntries(entries []textEntry, menus []choiceMenu) (grouped []textEntry) {
+	options := map[string]*choiceMenu{}
+	for i := range menus {
+		for _, o := range menus[i].Options {
+			options[o.Id] = &menus[i]
+		}
+	}
+	for _, e := range entries {
+		menu, ok := options[e.Id]
+		if !ok {
+			grouped = append(grouped, e)
+			continue
+		}
+		if menu.Options[0].Id != e.Id {
+			continue
+		}
+		lines := make([]string, len(menu.Options))
+		translated := false
+		translations := make([]string, len(menu.Options))
+		for i, o := range menu.Options {
+			lines[i] = o.Text
+			translations[i] = o.Text
+			if o.Translation != "" {
+				translations[i] = o.Translation
+				translated = true
+			}
+		}
+		e.Id = menuEntryId(menu.Id)
+		e.Kind = "menu"
+		e.Text = strings.Join(lines, "\n")
+		e.Translation = ""
+		if translated {
+			e.Translation = strings.Join(translations, "\n")
+		}
+		e.Notes = menuNotes(menu)
+		grouped = append(grouped, e)
+	}
+	return
+}
+
+// expandMenuTranslations maps the lines of translated menus back to the
+// option strings, unless an option has a translation of its own.
+func expandMenuTranslations(menus []choiceMenu, translations map[string]string) error {
+	for _, menu := range menus {
+		t, ok := translations[menuEntryId(menu.Id)]
+		if !ok || t == "" {
+			continue
+		}
+		lines := strings.Split(strings.ReplaceAll(t, "\r\n", "\n"), "\n")
+		if len(lines) != len(menu.Options) {
+			return fmt.Errorf("%s: the menu has %d options, the translation %d lines", menuEntryId(menu.Id), len(menu.Options), len(lines))
+		}
+		for i, o := range menu.Options {
+			if translations[o.Id] == "" {
+				translations[o.Id] = lines[i]
+			}
+		}
+	}
+	return nil
+}
+
+// loadChoiceMenus finds the menus of a single ybn or every ybn in a directory.
+func loadChoiceMenus(inputName string, key []byte, guessKey bool, ops *[256]string, codePage int) (menus []choiceMenu, err error) {
+	files := []string{inputName}
+	dir := filepath.Dir(inputName)
+	if isDir(inputName) {
+		files, err = listYbnFiles(inputName)
+		if err != nil {
+			return
+		}
+		dir = inputName
+		guessProjectOps(files, key, guessKey, ops)
+	}
+	project := loadProject(dir, codePage)
+	for _, file := range files {
+		stm, e := os.ReadFile(file)
+		if e != nil {
+			return nil, e
+		}
+		if ybnMagic(stm) != "YSTB" {
+			continue
+		}
+		fileKey := key
+		if guessKey {
+			fileKey = guessYstbKey(stm)
+		}
+		script, e := parseYstb(stm, fileKey, "")
+		if e != nil {
+			return nil, fmt.Errorf("%s: %v", file, e)
+		}
+		if !guessYstbOp(&script, ops) {
+			return nil, fmt.Errorf("%s: can't guess the opcode", file)
+		}
+		scriptMenus, e := ystbChoiceMenus(&script, scriptName(file), ops, codePage, project)
+		if e != nil {
+			return nil, fmt.Errorf("%s: %v", file, e)
+		}
+		menus = append(menus, scriptMenus...)
+	}
+	return
+}
+
+// extractChoiceMenus writes the menus of a game as json, or all strings with
+// the options of each menu as one string in a translation format chosen by
+// the extension of outName.
+func extractChoiceMenus(inputName, outName, inPoName, inXliffName, inCsvName, srcLang, trgLang string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	menus, err := loadChoiceMenus(inputName, key, guessKey, ops, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logf("found %d menus\n", len(menus))
+	translations, err := readTranslationFiles(inPoName, inXliffName, inCsvName)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	for i := range menus {
+		for j := range menus[i].Options {
+			o := &menus[i].Options[j]
+			o.Translation = translations[o.Id]
+		}
+	}
+	logln("writing:", outName)
+	if strings.ToLower(filepath.Ext(outName)) == ".json" {
+		var out []byte
+		if out, err = json.MarshalIndent(menus, "", "\t"); err != nil {
+			fmt.Println("error when marshalling json:", err)
+			return false
+		}
+		err = os.WriteFile(outName, out, os.ModePerm)
+	} else {
+		var entries []textEntry
+		entries, err = loadTextEntries(inputName, key, guessKey, ops, codePage)
+		if err == nil {
+			for i := range entries {
+				entries[i].Translation = translations[entries[i].Id]
+			}
+			err = writeTranslationFile(outName, groupMenuEntries(entries, menus), srcLang, trgLang)
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logln("complete.")
+	return true
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"github.com/regomne/eutil/codec"
+	"github.com/regomne/eutil/textFile"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// migrateMatches are how strings of the old build are found in the new one,
+// from the strictest to the loosest context.
+var migrateMatches = []struct {
+	Prev, Next bool
+}{
+	{true, true},
+	{true, false},
+	{false, true},
+	{false, false},
+}
+
+type migrateReport struct {
+	Migrated int
+	New      []textEntry
+	Removed  []textEntry
+	Changed  [][2]textEntry // old and new entry
+}
+
+// entryContext returns the text of the strings before and after entries[i]
+// in the same script.
+func entryContext(entries []textEntry, i int) (prev, next string) {
+	if i > 0 && entries[i-1].Script == entries[i].Script {
+		prev = entries[i-1].Text
+	}
+	if i+1 < len(entries) && entries[i+1].Script == entries[i].Script {
+		next = entries[i+1].Text
+	}
+	return
+}
+
+func migrateKey(entries []textEntry, i int, usePrev, useNext bool) string {
+	prev, next := entryContext(entries, i)
+	if !usePrev {
+		prev = ""
+	}
+	if !useNext {
+		next = ""
+	}
+	return strings.Join([]string{entries[i].Text, prev, next}, "\x00")
+}
+
+// matchEntries finds for every new entry the old entry with the same text,
+// preferring the ones with the same surrounding strings and in the same
+// script. The result holds the index of the old entry or -1.
+func matchEntries(oldEntries, newEntries []textEntry) []int {
+	matched := make([]int, len(newEntries))
+	for i := range matched {
+		matched[i] = -1
+	}
+	used := make([]bool, len(oldEntries))
+	for _, m := range migrateMatches {
+		candidates := map[string][]int{}
+		for j := range oldEntries {
+			if !used[j] {
+				k := migrateKey(oldEntries, j, m.Prev, m.Next)
+				candidates[k] = append(candidates[k], j)
+			}
+		}
+		for i := range newEntries {
+			if matched[i] >= 0 {
+				continue
+			}
+			k := migrateKey(newEntries, i, m.Prev, m.Next)
+			best := -1
+			for _, j := range candidates[k] {
+				if used[j] {
+					continue
+				}
+				if best < 0 {
+					best = j
+				}
+				if oldEntries[j].Script == newEntries[i].Script {
+					best = j
+					break
+				}
+			}
+			if best >= 0 {
+				matched[i] = best
+				used[best] = true
+			}
+		}
+	}
+	return matched
+}
+
+// textSimilarity is the share of characters of the longer text that the
+// other one has too.
+func textSimilarity(a, b string) float64 {
+	counts := map[rune]int{}
+	for _, r := range a {
+		counts[r]++
+	}
+	common := 0
+	for _, r := range b {
+		if counts[r] > 0 {
+			counts[r]--
+			common++
+		}
+	}
+	length := utf8.RuneCountInString(a)
+	if n := utf8.RuneCountInString(b); n > length {
+		length = n
+	}
+	if length == 0 {
+		return 1
+	}
+	return float64(common) / float64(length)
+}
+
+// changedEntry returns the unmatched old entry that was replaced by the
+// unmatched new entry i, or -1. It must lie between the old entries matched
+// to the neighbours of i, if there are several the most similar is taken.
+func changedEntry(oldEntries, newEntries []textEntry, matched []int, used []bool, i int) int {
+	first, last := -1, -1
+	if i > 0 && matched[i-1] >= 0 && newEntries[i-1].Script == newEntries[i].Script {
+		first = matched[i-1] + 1
+	}
+	if i+1 < len(newEntries) && matched[i+1] >= 0 && newEntries[i+1].Script == newEntries[i].Script {
+		last = matched[i+1] - 1
+	}
+	switch {
+	case first < 0 && last < 0:
+		return -1
+	case first < 0:
+		first = last
+	case last < 0:
+		last = first
+	}
+	best := -1
+	bestSimilarity := -1.0
+	for j := first; j <= last && j < len(oldEntries); j++ {
+		if used[j] || oldEntries[j].Script != newEntries[i].Script || oldEntries[j].Kind != newEntries[i].Kind {
+			continue
+		}
+		if s := textSimilarity(oldEntries[j].Text, newEntries[i].Text); s > bestSimilarity {
+			best = j
+			bestSimilarity = s
+		}
+	}
+	return best
+}
+
+// migrateEntries carries the translations of the old entries over to the new
+// ones. Changed strings are reported but not translated.
+func migrateEntries(oldEntries, newEntries []textEntry, translations map[string]string) (report migrateReport) {
+	matched := matchEntries(oldEntries, newEntries)
+	used := make([]bool, len(oldEntries))
+	for _, j := range matched {
+		if j >= 0 {
+			used[j] = true
+		}
+	}
+	for i := range newEntries {
+		if j := matched[i]; j >= 0 {
+			if t := translations[oldEntries[j].Id]; t != "" {
+				newEntries[i].Translation = t
+				report.Migrated++
+			}
+			continue
+		}
+		if j := changedEntry(oldEntries, newEntries, matched, used, i); j >= 0 {
+			used[j] = true
+			old := oldEntries[j]
+			old.Translation = translations[old.Id]
+			report.Changed = append(report.Changed, [2]textEntry{old, newEntries[i]})
+			continue
+		}
+		report.New = append(report.New, newEntries[i])
+	}
+	for j := range oldEntries {
+		if !used[j] {
+			report.Removed = append(report.Removed, oldEntries[j])
+		}
+	}
+	return
+}
+
+func (report *migrateReport) print() {
+	for _, e := range report.New {
+		fmt.Printf("new: %s: %q\n", e.Id, e.Text)
+	}
+	for _, e := range report.Removed {
+		fmt.Printf("removed: %s: %q\n", e.Id, e.Text)
+	}
+	for _, c := range report.Changed {
+		fmt.Printf("changed: %s -> %s: %q -> %q\n", c[0].Id, c[1].Id, c[0].Text, c[1].Text)
+		if c[0].Translation != "" {
+			fmt.Printf("\told translation: %q\n", c[0].Translation)
+		}
+	}
+	fmt.Printf("%d translations migrated, %d new, %d removed, %d changed strings\n",
+		report.Migrated, len(report.New), len(report.Removed), len(report.Changed))
+}
+
+// readTxtTranslations maps the entries of a single ybn to the lines of its
+// txt file that differ from the original.
+func readTxtTranslations(txtName string, entries []textEntry) (translations map[string]string, err error) {
+	ls, err := textFile.ReadWin32TxtToLines(txtName)
+	if err != nil {
+		return
+	}
+	if len(ls) != len(entries) {
+		err = fmt.Errorf("%s has %d lines, the ybn has %d strings", txtName, len(ls), len(entries))
+		return
+	}
+	translations = map[string]string{}
+	for i, e := range entries {
+		if ls[i] != e.Text {
+			translations[e.Id] = ls[i]
+		}
+	}
+	return
+}
+
+// writeTranslationFile writes the entries in the format given by the
+// extension of the file name.
+func writeTranslationFile(fileName string, entries []textEntry, srcLang, trgLang string) error {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".po":
+		return writePo(fileName, entries, false)
+	case ".pot":
+		return writePo(fileName, entries, true)
+	case ".xliff", ".xlf":
+		return writeXliff(fileName, entries, srcLang, trgLang)
+	case ".csv", ".tsv":
+		return writeCsv(fileName, entries)
+	case ".txt":
+		lines := make([]string, len(entries))
+		for i, e := range entries {
+			lines[i] = e.Text
+			if e.Translation != "" {
+				lines[i] = e.Translation
+			}
+		}
+		return os.WriteFile(fileName, codec.Encode(strings.Join(lines, "\r\n"), codec.UTF8Sig, codec.Replace), os.ModePerm)
+	}
+	return fmt.Errorf("unknown translation file type: %s", fileName)
+}
+
+// migrateTranslation carries a translation of the old build of a game over
+// to the new one, matching strings by their text and the strings around
+// them, and writes it to outName.
+func migrateTranslation(oldName, newName, inTxtName, inPoName, inXliffName, inCsvName, outName, srcLang, trgLang string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	if inTxtName != "" && isDir(oldName) || strings.ToLower(filepath.Ext(outName)) == ".txt" && isDir(newName) {
+		fmt.Println("txt files can only be migrated for single ybn files")
+		return false
+	}
+	oldEntries, err := loadTextEntries(oldName, key, guessKey, ops, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	newEntries, err := loadTextEntries(newName, key, guessKey, ops, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logf("%d old and %d new strings\n", len(oldEntries), len(newEntries))
+	var translations map[string]string
+	if inTxtName != "" {
+		logln("reading txt:", inTxtName)
+		translations, err = readTxtTranslations(inTxtName, oldEntries)
+	} else {
+		translations, err = readTranslationFiles(inPoName, inXliffName, inCsvName)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	report := migrateEntries(oldEntries, newEntries, translations)
+	report.print()
+	logln("writing:", outName)
+	if err := writeTranslationFile(outName, newEntries, srcLang, trgLang); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logln("complete.")
+	return true
+}
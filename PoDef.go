@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type poEntry struct {
+	Context string
+	Id      string
+	Str     string
+	Fuzzy   bool
+}
+
+func poQuote(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	s = strings.ReplaceAll(s, "\t", "\\t")
+	s = strings.ReplaceAll(s, "\r", "\\r")
+	s = strings.ReplaceAll(s, "\n", "\\n")
+	return "\"" + s + "\""
+}
+
+// poString formats a keyword with its string, splitting it after line breaks
+// the way gettext tools do.
+func poString(keyword, s string) string {
+	if !strings.Contains(s, "\n") || strings.Index(s, "\n") == len(s)-1 {
+		return keyword + " " + poQuote(s) + "\n"
+	}
+	out := keyword + " \"\"\n"
+	for len(s) > 0 {
+		i := strings.Index(s, "\n")
+		if i < 0 {
+			i = len(s) - 1
+		}
+		out += poQuote(s[:i+1]) + "\n"
+		s = s[i+1:]
+	}
+	return out
+}
+
+func poUnquote(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("malformatted string: %s", s)
+	}
+	var sb strings.Builder
+	s = s[1 : len(s)-1]
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'a':
+			sb.WriteByte('\a')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'v':
+			sb.WriteByte('\v')
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// writePo writes entries as a gettext catalog. With template set every
+// msgstr is left empty (pot), otherwise existing translations are kept.
+func writePo(fileName string, entries []textEntry, template bool) error {
+	out := "msgid \"\"\nmsgstr \"\"\n"
+	out += "\"Project-Id-Version: extYuRis\\n\"\n"
+	out += "\"MIME-Version: 1.0\\n\"\n"
+	out += "\"Content-Type: text/plain; charset=UTF-8\\n\"\n"
+	out += "\"Content-Transfer-Encoding: 8bit\\n\"\n"
+	for _, e := range entries {
+		out += "\n"
+		if e.Speaker != "" {
+			out += "# speaker: " + e.Speaker + "\n"
+		}
+		if e.Function != "" {
+			out += "#. " + e.Kind + ": " + e.Function + "\n"
+		} else {
+			out += "#. " + e.Kind + "\n"
+		}
+		if e.Label != "" {
+			out += "#. label: " + e.Label + "\n"
+		}
+		for _, note := range e.Notes {
+			out += "#. " + note + "\n"
+		}
+		ref := e.Script + ".ybn"
+		if e.Source != "" {
+			ref = strings.ReplaceAll(e.Source, " ", "_")
+		}
+		out += "#: " + ref + ":" + e.Id[strings.Index(e.Id, ":")+1:] + "\n"
+		out += poString("msgctxt", e.Id)
+		out += poString("msgid", e.Text)
+		if template {
+			out += "msgstr \"\"\n"
+		} else {
+			out += poString("msgstr", e.Translation)
+		}
+	}
+	return os.WriteFile(fileName, []byte(out), os.ModePerm)
+}
+
+// readPo parses the entries of a po or pot file. Plural forms are read as
+// their first form, obsolete entries are skipped.
+func readPo(fileName string) (entries []poEntry, err error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var cur poEntry
+	var target *string
+	hasStr := false
+	flush := func() {
+		if hasStr {
+			entries = append(entries, cur)
+		}
+		cur = poEntry{}
+		target = nil
+		hasStr = false
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#~") {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if hasStr {
+				flush()
+			}
+			if strings.HasPrefix(line, "#,") && strings.Contains(line, "fuzzy") {
+				cur.Fuzzy = true
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "\"") {
+			if target == nil {
+				return nil, fmt.Errorf("line %d: string without keyword", lineNo)
+			}
+			s, e := poUnquote(line)
+			if e != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, e)
+			}
+			*target += s
+			continue
+		}
+		keyword, rest, _ := strings.Cut(line, " ")
+		switch {
+		case keyword == "msgctxt":
+			if hasStr {
+				flush()
+			}
+			target = &cur.Context
+		case keyword == "msgid":
+			if hasStr {
+				flush()
+			}
+			target = &cur.Id
+		case keyword == "msgid_plural":
+			target = new(string)
+		case keyword == "msgstr" || keyword == "msgstr[0]":
+			target = &cur.Str
+			hasStr = true
+		case strings.HasPrefix(keyword, "msgstr["):
+			target = new(string)
+		default:
+			return nil, fmt.Errorf("line %d: unknown keyword %s", lineNo, strconv.Quote(keyword))
+		}
+		s, e := poUnquote(rest)
+		if e != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, e)
+		}
+		*target = s
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	flush()
+	return
+}
+
+// poTranslations maps msgctxt to msgstr. Fuzzy and empty entries are left
+// out, so packing falls back to the msgid for them.
+func poTranslations(entries []poEntry) map[string]string {
+	translations := map[string]string{}
+	for _, e := range entries {
+		if e.Context == "" || e.Fuzzy || e.Str == "" {
+			continue
+		}
+		translations[e.Context] = e.Str
+	}
+	return translations
+}
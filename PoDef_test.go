@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPoQuoteRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"plain",
+		`say "hi"`,
+		`back\slash`,
+		"tab\there",
+		"line\r\nbreak\n",
+		"「日本語」",
+	} {
+		got, err := poUnquote(poQuote(s))
+		if err != nil || got != s {
+			t.Errorf("poUnquote(poQuote(%q)) = %q, %v", s, got, err)
+		}
+	}
+}
+
+func TestPoUnquote(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{`"abc"`, "abc", true},
+		{`  "a\nb"  `, "a\nb", true},
+		{`"\a\b\f\v"`, "\a\b\f\v", true},
+		{`"\q"`, "q", true},
+		{`"trailing\"`, `trailing\`, true},
+		{`abc`, "", false},
+		{`"`, "", false},
+		{`"open`, "", false},
+	}
+	for _, tt := range tests {
+		got, err := poUnquote(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("poUnquote(%s) = %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestReadPo(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "t.po")
+	po := "\ufeffmsgid \"\"\n" +
+		"msgstr \"\"\n" +
+		"\"Content-Type: text/plain; charset=UTF-8\\n\"\n" +
+		"\n" +
+		"# speaker: A\n" +
+		"#: start.yst:3\n" +
+		"msgctxt \"yst00000:3:0\"\n" +
+		"msgid \"\"\n" +
+		"\"one\\n\"\n" +
+		"\"two\"\n" +
+		"msgstr \"eins\\nzwei\"\n" +
+		"\n" +
+		"#, fuzzy\n" +
+		"msgctxt \"yst00000:4:0\"\n" +
+		"msgid \"fuzzy\"\n" +
+		"msgstr \"unsure\"\n" +
+		"\n" +
+		"msgctxt \"yst00000:5:0\"\n" +
+		"msgid \"apple\"\n" +
+		"msgid_plural \"apples\"\n" +
+		"msgstr[0] \"Apfel\"\n" +
+		"msgstr[1] \"Äpfel\"\n" +
+		"\n" +
+		"msgctxt \"yst00000:6:0\"\n" +
+		"msgid \"untranslated\"\n" +
+		"msgstr \"\"\n" +
+		"\n" +
+		"#~ msgctxt \"yst00000:7:0\"\n" +
+		"#~ msgid \"obsolete\"\n" +
+		"#~ msgstr \"alt\"\n"
+	if err := os.WriteFile(name, []byte(po), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := readPo(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []poEntry{
+		{Str: "Content-Type: text/plain; charset=UTF-8\n"},
+		{Context: "yst00000:3:0", Id: "one\ntwo", Str: "eins\nzwei"},
+		{Context: "yst00000:4:0", Id: "fuzzy", Str: "unsure", Fuzzy: true},
+		{Context: "yst00000:5:0", Id: "apple", Str: "Apfel"},
+		{Context: "yst00000:6:0", Id: "untranslated"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("readPo =\n%#v\nwant\n%#v", entries, want)
+	}
+	translations := poTranslations(entries)
+	wantTranslations := map[string]string{"yst00000:3:0": "eins\nzwei", "yst00000:5:0": "Apfel"}
+	if !reflect.DeepEqual(translations, wantTranslations) {
+		t.Errorf("poTranslations = %v, want %v", translations, wantTranslations)
+	}
+}
+
+func TestReadPoErrors(t *testing.T) {
+	for _, po := range []string{
+		"\"orphan\"\n",
+		"msgid \"a\"\nmsgfoo \"b\"\n",
+		"msgid \"a\nmsgstr \"b\"\n",
+	} {
+		name := filepath.Join(t.TempDir(), "t.po")
+		os.WriteFile(name, []byte(po), os.ModePerm)
+		if _, err := readPo(name); err == nil {
+			t.Errorf("readPo(%q) succeeded", po)
+		}
+	}
+}
+
+func TestWritePoRoundTrip(t *testing.T) {
+	entries := []textEntry{
+		{Id: "yst00001:2:0", Script: "yst00001", Kind: "message", Speaker: "A", Text: "first\nsecond", Translation: "erste\nzweite"},
+		{Id: "yst00001:3:1", Script: "yst00001", Kind: "choice", Function: "es.sel.set", Source: "data\\script\\a b.yst", Text: `"quoted"`},
+	}
+	dir := t.TempDir()
+	for _, template := range []bool{false, true} {
+		name := filepath.Join(dir, "t.po")
+		if err := writePo(name, entries, template); err != nil {
+			t.Fatal(err)
+		}
+		read, err := readPo(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(read) != len(entries)+1 {
+			t.Fatalf("template %v: read %d entries, want %d", template, len(read), len(entries)+1)
+		}
+		for i, e := range entries {
+			got := read[i+1]
+			want := e.Translation
+			if template {
+				want = ""
+			}
+			if got.Context != e.Id || got.Id != e.Text || got.Str != want {
+				t.Errorf("template %v: entry %d = %#v", template, i, got)
+			}
+		}
+	}
+}
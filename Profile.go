@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// profileInfo holds the game specific extraction settings that can't be
+// guessed reliably.
+type profileInfo struct {
+	TextFunctions []string      // call functions whose string arguments are text, like es.msg.log
+	AllStrings    bool          `json:",omitempty"` // extract every translatable string argument of every call
+	Allow         []literalRule `json:",omitempty"` // string arguments that are always extracted
+	Deny          []literalRule `json:",omitempty"` // string arguments that are never extracted, wins over Allow
+}
+
+// literalRule selects string arguments by the function they are passed to
+// and their text. Empty fields match everything.
+type literalRule struct {
+	Function string `json:",omitempty"` // pattern like es.file.*
+	Text     string `json:",omitempty"` // regular expression, quotes included
+
+	text *regexp.Regexp
+}
+
+func (r *literalRule) matches(function, text string) bool {
+	if r.Function != "" {
+		if ok, _ := path.Match(strings.ToLower(r.Function), function); !ok {
+			return false
+		}
+	}
+	return r.text == nil || r.text.MatchString(text)
+}
+
+var gProfile profileInfo
+
+func readProfile(fileName string) (profile profileInfo, err error) {
+	stm, err := os.ReadFile(fileName)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(stm, &profile); err != nil {
+		return
+	}
+	for _, rules := range [][]literalRule{profile.Allow, profile.Deny} {
+		for i := range rules {
+			if rules[i].Text == "" {
+				continue
+			}
+			if rules[i].text, err = regexp.Compile(rules[i].Text); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func writeProfile(fileName string, profile *profileInfo) error {
+	out, err := json.MarshalIndent(profile, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, out, os.ModePerm)
+}
+
+// quotedFunctionName returns a function name as it is stored in the call
+// instruction, lower case and in quotes.
+func quotedFunctionName(name string) string {
+	return `"` + strings.ToLower(strings.Trim(name, `"`)) + `"`
+}
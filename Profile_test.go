@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteProfile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "profile.json")
+	profile := profileInfo{
+		TextFunctions: []string{"es.msg.log", "es.note"},
+		AllStrings:    true,
+		Allow:         []literalRule{{Function: "es.file.*", Text: `^"title`}},
+		Deny:          []literalRule{{Text: `\.ogg"$`}},
+	}
+	if err := writeProfile(name, &profile); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readProfile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.TextFunctions, profile.TextFunctions) || !got.AllStrings {
+		t.Errorf("readProfile = %+v", got)
+	}
+	if !got.Allow[0].matches("es.file.open", `"title.png"`) || got.Allow[0].matches("es.snd.play", `"title.png"`) {
+		t.Errorf("allow rule %+v matches wrongly", got.Allow[0])
+	}
+	if !got.Deny[0].matches("es.snd.play", `"se/a.ogg"`) || got.Deny[0].matches("es.snd.play", `"se/a.wav"`) {
+		t.Errorf("deny rule %+v matches wrongly", got.Deny[0])
+	}
+
+	// empty fields are left out
+	if err := writeProfile(name, &profileInfo{TextFunctions: []string{"es.note"}}); err != nil {
+		t.Fatal(err)
+	}
+	stm, _ := os.ReadFile(name)
+	if want := "{\n\t\"TextFunctions\": [\n\t\t\"es.note\"\n\t]\n}"; string(stm) != want {
+		t.Errorf("profile = %s, want %s", stm, want)
+	}
+}
+
+func TestReadProfileErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, text := range []string{`{"Deny": [{"Text": "("}]}`, `{"TextFunctions": "es.note"}`} {
+		name := filepath.Join(dir, "profile.json")
+		os.WriteFile(name, []byte(text), os.ModePerm)
+		if _, err := readProfile(name); err == nil {
+			t.Errorf("readProfile(%s) succeeded", text)
+		}
+	}
+	if _, err := readProfile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("readProfile of a missing file succeeded")
+	}
+}
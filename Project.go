@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// projectInfo holds the per-game tables that give context to single scripts:
+// the labels from ysl.ybn, the source names from yst_list.ybn and the
+// command names from ysc.ybn.
+type projectInfo struct {
+	Labels   map[uint32][]yslbLabel // by ScriptId, sorted by CommandIndex
+	Scripts  map[uint32]ystlScriptInfo
+	Commands []string // by opcode
+}
+
+func ybnMagic(stm []byte) string {
+	if len(stm) < 4 {
+		return ""
+	}
+	return strings.ToUpper(string(stm[:4]))
+}
+
+func isDir(name string) bool {
+	st, err := os.Stat(name)
+	return err == nil && st.IsDir()
+}
+
+// listYbnFiles returns all .ybn files in dir, sorted by name.
+func listYbnFiles(dir string) (files []string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.ToLower(filepath.Ext(e.Name())) == ".ybn" {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return
+}
+
+// scriptName returns the file name of a ybn without directory and extension.
+func scriptName(ybnName string) string {
+	base := filepath.Base(ybnName)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// scriptIdOfName parses the id out of a name like yst00012.ybn.
+func scriptIdOfName(ybnName string) (uint32, bool) {
+	name := strings.ToLower(scriptName(ybnName))
+	if !strings.HasPrefix(name, "yst") {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(name[3:], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(id), true
+}
+
+// loadProject reads the label and script tables from dir. Missing or broken
+// tables are skipped, the returned project is never nil.
+func loadProject(dir string, codePage int) *projectInfo {
+	project := &projectInfo{
+		Labels:  map[uint32][]yslbLabel{},
+		Scripts: map[uint32]ystlScriptInfo{},
+	}
+	files, err := listYbnFiles(dir)
+	if err != nil {
+		return project
+	}
+	for _, file := range files {
+		stm, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		switch ybnMagic(stm) {
+		case "YSLB":
+			logln("loading labels:", file)
+			lb, err := parseYslb(stm, codePage)
+			if err != nil {
+				continue
+			}
+			for _, label := range lb.Labels {
+				project.Labels[uint32(label.ScriptId)] = append(project.Labels[uint32(label.ScriptId)], label)
+			}
+		case "YSCM":
+			logln("loading commands:", file)
+			cm, err := parseYscm(stm, codePage)
+			if err != nil {
+				continue
+			}
+			project.Commands = make([]string, len(cm.Commands))
+			for i, cmd := range cm.Commands {
+				project.Commands[i] = strings.ToUpper(cmd.Name)
+			}
+		case "YSTL":
+			logln("loading script list:", file)
+			tl, err := parseYstl(stm, codePage)
+			if err != nil {
+				continue
+			}
+			for _, scr := range tl.Scripts {
+				project.Scripts[scr.Id] = scr
+			}
+		}
+	}
+	for id := range project.Labels {
+		labels := project.Labels[id]
+		sort.SliceStable(labels, func(i, j int) bool {
+			return labels[i].CommandIndex < labels[j].CommandIndex
+		})
+	}
+	return project
+}
+
+// labelAt returns the name of the last label at or before the instruction.
+func (p *projectInfo) labelAt(scriptId uint32, inst int) string {
+	name := ""
+	for _, label := range p.Labels[scriptId] {
+		if int(label.CommandIndex) > inst {
+			break
+		}
+		name = label.Name
+	}
+	return name
+}
+
+// labelName returns the name of the label with the id, or "" if unknown.
+func (p *projectInfo) labelName(id uint32) string {
+	for _, labels := range p.Labels {
+		for _, label := range labels {
+			if label.Id == id {
+				return label.Name
+			}
+		}
+	}
+	return ""
+}
+
+// commandName returns the upper case name of an opcode, like IF, or "" if
+// ysc.ybn wasn't found.
+func (p *projectInfo) commandName(op uint8) string {
+	if p == nil || int(op) >= len(p.Commands) {
+		return ""
+	}
+	return p.Commands[op]
+}
+
+// sourceOf returns the source file of a script, or "" if unknown.
+func (p *projectInfo) sourceOf(scriptId uint32) string {
+	return p.Scripts[scriptId].Source
+}
+
+// guessProjectOps guesses the opcodes from the scripts in files, trying one
+// after another until a script has enough text to do so.
+func guessProjectOps(files []string, key []byte, guessKey bool, ops *[256]string) bool {
+	for _, file := range files {
+		stm, err := os.ReadFile(file)
+		if err != nil || ybnMagic(stm) != "YSTB" {
+			continue
+		}
+		fileKey := key
+		if guessKey {
+			fileKey = guessYstbKey(stm)
+		}
+		script, err := parseYstb(stm, fileKey, "")
+		if err != nil {
+			continue
+		}
+		if guessYstbOp(&script, ops) {
+			return true
+		}
+	}
+	return false
+}
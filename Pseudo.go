@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// pseudoAccents are the replacements tried for every ASCII letter, the first
+// one the code page can encode is taken. Code pages without accented letters
+// get the full-width letter.
+var pseudoAccents = map[rune]string{
+	'A': "ÅÄÀÁÂ", 'a': "åäàáâ",
+	'C': "ÇĆ", 'c': "çć",
+	'D': "ÐĎ", 'd': "ðď",
+	'E': "ÉÈÊË", 'e': "éèêë",
+	'G': "ĜĞ", 'g': "ĝğ",
+	'H': "ĤĦ", 'h': "ĥħ",
+	'I': "ÎÍÌÏ", 'i': "îíìï",
+	'J': "Ĵ", 'j': "ĵ",
+	'K': "Ķ", 'k': "ķ",
+	'L': "ĹŁ", 'l': "ĺł",
+	'N': "ÑŃ", 'n': "ñń",
+	'O': "ÖÓÒÔØ", 'o': "öóòôø",
+	'R': "ŔŘ", 'r': "ŕř",
+	'S': "ŠŚ", 's': "šś",
+	'T': "ŢŤ", 't': "ţť",
+	'U': "ÜÚÙÛ", 'u': "üúùû",
+	'W': "Ŵ", 'w': "ŵ",
+	'Y': "ÝŸ", 'y': "ýÿ",
+	'Z': "ŽŹ", 'z': "žź",
+}
+
+type pseudoConfig struct {
+	Expansion float64 // added width relative to the original
+	Accents   map[rune]rune
+	Padding   string
+}
+
+// encodable tells whether r survives encoding in the code page.
+func encodable(r rune, codePage int) bool {
+	return decodeChars(encodeChars(string(r), codePage, nil), codePage) == string(r)
+}
+
+func newPseudoConfig(expansion float64, codePage int) *pseudoConfig {
+	cfg := &pseudoConfig{Expansion: expansion, Accents: map[rune]rune{}, Padding: "~"}
+	for r, candidates := range pseudoAccents {
+		for _, c := range candidates + string(r+0xFEE0) {
+			if encodable(c, codePage) {
+				cfg.Accents[r] = c
+				break
+			}
+		}
+	}
+	return cfg
+}
+
+// pseudoLocalize accents the letters of s, pads it to the expanded width and
+// puts it in brackets. Control sequences and the quotes of string arguments
+// are kept as they are.
+func pseudoLocalize(s string, cfg *pseudoConfig, codePage int) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[:1] + pseudoLocalize(s[1:len(s)-1], cfg, codePage) + s[:1]
+	}
+	if s == "" {
+		return s
+	}
+	var sb strings.Builder
+	sb.WriteString("[")
+	width := 0
+	for _, token := range tokenizeMessage(s) {
+		if token.Kind != "text" {
+			sb.WriteString(token.Text)
+			continue
+		}
+		for _, r := range token.Text {
+			width += runeWidth(r, codePage)
+			if a, ok := cfg.Accents[r]; ok {
+				r = a
+			}
+			sb.WriteRune(r)
+		}
+	}
+	padding := int(math.Ceil(float64(width) * cfg.Expansion))
+	sb.WriteString(strings.Repeat(cfg.Padding, padding/len(cfg.Padding)))
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// packPseudoLocalized packs a ybn or every ybn of a directory with all strings
+// pseudo-localized, so untranslated text and overflowing boxes stand out
+// in the game.
+func packPseudoLocalized(inputName, outYbnName string, expansion float64, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	entries, err := loadTextEntries(inputName, key, guessKey, ops, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	cfg := newPseudoConfig(expansion, codePage)
+	translations := map[string]string{}
+	for _, e := range entries {
+		translations[e.Id] = pseudoLocalize(e.Text, cfg, codePage)
+	}
+	logf("pseudo-localized %d strings\n", len(translations))
+	if !packTranslations(inputName, outYbnName, translations, key, guessKey, ops, codePage) {
+		return false
+	}
+	logln("complete.")
+	return true
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// textEntry is one translatable string with the context the translation
+// exchange formats (po, ...) carry along with it.
+type textEntry struct {
+	Id          string // stable, e.g. yst00012:145:0 = script:instruction:argument
+	Script      string
+	Kind        string // message, choice, menu, name, tips, input, function, error
+	Function    string `json:",omitempty"`
+	Speaker     string `json:",omitempty"`
+	Label       string `json:",omitempty"`
+	Source      string `json:",omitempty"`
+	Text        string
+	Translation string   `json:",omitempty"`
+	Notes       []string `json:",omitempty"` // for translators, like where menu options lead
+}
+
+func textKindOfFunction(name string) string {
+	switch {
+	case strings.HasPrefix(name, "es.sel."):
+		return "choice"
+	case strings.HasPrefix(name, "es.char.name"):
+		return "name"
+	case strings.HasPrefix(name, "es.tips."):
+		return "tips"
+	case strings.HasPrefix(name, "es.input."):
+		return "input"
+	}
+	return "function"
+}
+
+// speakerOfMessage returns the name of a message starting with 【name】.
+func speakerOfMessage(text string) string {
+	if !strings.HasPrefix(text, "【") {
+		return ""
+	}
+	end := strings.Index(text, "】")
+	if end < 0 {
+		return ""
+	}
+	return text[len("【"):end]
+}
+
+func ystbTextEntries(script *ystbInfo, name string, ops *[256]string, codePage int, project *projectInfo) (entries []textEntry, err error) {
+	refs, err := ystbTextRefs(script, ops, codePage)
+	if err != nil {
+		return
+	}
+	scriptId, hasId := scriptIdOfName(name)
+	entries = make([]textEntry, len(refs))
+	for i, ref := range refs {
+		e := &entries[i]
+		e.Id = ystbRefId(name, ref)
+		e.Script = name
+		e.Text = decodeText(ystbRefBytes(script, ref), codePage)
+		inst := &script.Insts[ref.Inst]
+		if ops[inst.Op] == "msg" {
+			e.Kind = "message"
+			e.Speaker = speakerOfMessage(e.Text)
+		} else {
+			e.Function = strings.Trim(string(inst.Args[0].Res.Res), "\"")
+			e.Kind = textKindOfFunction(e.Function)
+		}
+		if hasId && project != nil {
+			e.Label = project.labelAt(scriptId, ref.Inst)
+			e.Source = project.sourceOf(scriptId)
+		}
+	}
+	return
+}
+
+func yscmTextEntries(script *yscmInfo, name string) []textEntry {
+	entries := make([]textEntry, len(script.ErrorMessages))
+	for i, msg := range script.ErrorMessages {
+		entries[i] = textEntry{
+			Id:     fmt.Sprintf("%s:%d", name, i),
+			Script: name,
+			Kind:   "error",
+			Text:   msg,
+		}
+	}
+	return entries
+}
+
+func yserTextEntries(script *yserInfo, name string) []textEntry {
+	entries := make([]textEntry, len(script.ErrorMessages))
+	for i, msg := range script.ErrorMessages {
+		entries[i] = textEntry{
+			Id:     fmt.Sprintf("%s:%d", name, msg.Code),
+			Script: name,
+			Kind:   "error",
+			Text:   msg.Message,
+		}
+	}
+	return entries
+}
+
+// loadYbnTextEntries reads the translatable strings of a YSTB, YSCM or YSER
+// file. Other formats have no text and return no entries.
+func loadYbnTextEntries(ybnName string, key []byte, guessKey bool, ops *[256]string, codePage int, project *projectInfo) (entries []textEntry, err error) {
+	logln("reading file:", ybnName)
+	oriStm, err := os.ReadFile(ybnName)
+	if err != nil {
+		return
+	}
+	name := scriptName(ybnName)
+	switch ybnMagic(oriStm) {
+	case "YSTB":
+		if guessKey {
+			key = guessYstbKey(oriStm)
+		}
+		script, e := parseYstb(oriStm, key, "")
+		if e != nil {
+			return nil, e
+		}
+		if !guessYstbOp(&script, ops) {
+			return nil, fmt.Errorf("can't guess the opcode")
+		}
+		return ystbTextEntries(&script, name, ops, codePage, project)
+	case "YSCM":
+		script, e := parseYscm(oriStm, codePage)
+		if e != nil {
+			return nil, e
+		}
+		return yscmTextEntries(&script, name), nil
+	case "YSER":
+		script, e := parseYser(oriStm, codePage)
+		if e != nil {
+			return nil, e
+		}
+		return yserTextEntries(&script, name), nil
+	}
+	return
+}
+
+// loadTextEntries loads a single ybn or every ybn in a directory, together with
+// the project tables found next to it.
+func loadTextEntries(inputName string, key []byte, guessKey bool, ops *[256]string, codePage int) (entries []textEntry, err error) {
+	files := []string{inputName}
+	dir := inputName
+	if isDir(inputName) {
+		files, err = listYbnFiles(inputName)
+		if err != nil {
+			return
+		}
+		guessProjectOps(files, key, guessKey, ops)
+	} else {
+		dir = filepath.Dir(inputName)
+	}
+	project := loadProject(dir, codePage)
+	for _, file := range files {
+		es, e := loadYbnTextEntries(file, key, guessKey, ops, codePage, project)
+		if e != nil {
+			return nil, fmt.Errorf("%s: %v", file, e)
+		}
+		entries = append(entries, es...)
+	}
+	return
+}
+
+// translatedLines returns the text of entries with translations applied,
+// falling back to the original where there is none.
+func translatedLines(entries []textEntry, translations map[string]string) []string {
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[i] = e.Text
+		if t, ok := translations[e.Id]; ok && t != "" {
+			lines[i] = t
+		}
+	}
+	return lines
+}
+
+// packYbnTranslations writes a copy of a YSTB, YSCM or YSER file with the
+// strings replaced by their translations, looked up by entry id.
+func packYbnTranslations(ybnName, outYbnName string, translations map[string]string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	logln("reading file:", ybnName)
+	oriStm, err := os.ReadFile(ybnName)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	name := scriptName(ybnName)
+	var newStm []byte
+	switch ybnMagic(oriStm) {
+	case "YSTB":
+		if guessKey {
+			key = guessYstbKey(oriStm)
+		}
+		script, err := parseYstb(oriStm, key, "")
+		if err != nil {
+			fmt.Println("parse error:", err)
+			return false
+		}
+		if !guessYstbOp(&script, ops) {
+			fmt.Println("Can't guess the opcode")
+			return false
+		}
+		entries, err := ystbTextEntries(&script, name, ops, codePage, nil)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		menus, err := ystbChoiceMenus(&script, name, ops, codePage, nil)
+		if err == nil {
+			err = expandMenuTranslations(menus, translations)
+		}
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		newStm, err = packTxtToYstb(&script, name, oriStm, translatedLines(entries, translations), ops, codePage, key)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+	case "YSCM":
+		script, err := parseYscm(oriStm, codePage)
+		if err != nil {
+			fmt.Println("parse error:", err)
+			return false
+		}
+		newStm = packTxtToYscm(&script, oriStm, translatedLines(yscmTextEntries(&script, name), translations), codePage)
+	case "YSER":
+		script, err := parseYser(oriStm, codePage)
+		if err != nil {
+			fmt.Println("parse error:", err)
+			return false
+		}
+		lines := translatedLines(yserTextEntries(&script, name), translations)
+		msgs := make([]yserErrorMessage, len(lines))
+		for i := range msgs {
+			msgs[i].Code = script.ErrorMessages[i].Code
+			msgs[i].Message = lines[i]
+		}
+		newStm = packTxtToYser(&script, oriStm, msgs, codePage)
+	default:
+		logln("no text to pack in:", ybnName)
+		return true
+	}
+	logln("writing ybn:", outYbnName)
+	os.WriteFile(outYbnName, newStm, os.ModePerm)
+	return true
+}
+
+// packTranslations packs a single ybn, or every ybn of a directory into the
+// output directory.
+func packTranslations(inputName, outName string, translations map[string]string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	if !isDir(inputName) {
+		return packYbnTranslations(inputName, outName, translations, key, guessKey, ops, codePage)
+	}
+	files, err := listYbnFiles(inputName)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	guessProjectOps(files, key, guessKey, ops)
+	os.MkdirAll(outName, os.ModePerm)
+	for _, file := range files {
+		if !packYbnTranslations(file, filepath.Join(outName, filepath.Base(file)), translations, key, guessKey, ops, codePage) {
+			return false
+		}
+	}
+	return true
+}
+
+// readTranslationFiles merges the translations of the given po, xliff and
+// csv files; empty names are skipped.
+func readTranslationFiles(poName, xliffName, csvName string) (translations map[string]string, err error) {
+	translations = map[string]string{}
+	if poName != "" {
+		logln("reading po:", poName)
+		entries, e := readPo(poName)
+		if e != nil {
+			return nil, e
+		}
+		translations = poTranslations(entries)
+	}
+	if xliffName != "" {
+		logln("reading xliff:", xliffName)
+		doc, e := readXliff(xliffName)
+		if e != nil {
+			return nil, e
+		}
+		for id, t := range xliffTranslations(&doc) {
+			translations[id] = t
+		}
+	}
+	if csvName != "" {
+		logln("reading csv:", csvName)
+		csvTranslations, e := readCsvTranslations(csvName)
+		if e != nil {
+			return nil, e
+		}
+		for id, t := range csvTranslations {
+			translations[id] = t
+		}
+	}
+	logf("read %d translations\n", len(translations))
+	return
+}
+
+func extractTranslationFiles(inputName, outPoName, outPotName, outXliffName, outCsvName, tmxName, srcLang, trgLang string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	entries, err := loadTextEntries(inputName, key, guessKey, ops, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logf("extracted %d strings\n", len(entries))
+	if tmxName != "" {
+		logln("reading tmx:", tmxName)
+		tm, err := readTmx(tmxName, srcLang, trgLang)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		logf("filled %d strings from translation memory\n", tm.fillEntries(entries))
+	}
+	if outPotName != "" {
+		logln("writing pot:", outPotName)
+		if err := writePo(outPotName, entries, true); err != nil {
+			fmt.Println(err)
+			return false
+		}
+	}
+	if outPoName != "" {
+		logln("writing po:", outPoName)
+		if err := writePo(outPoName, entries, false); err != nil {
+			fmt.Println(err)
+			return false
+		}
+	}
+	if outXliffName != "" {
+		logln("writing xliff:", outXliffName)
+		if err := writeXliff(outXliffName, entries, srcLang, trgLang); err != nil {
+			fmt.Println(err)
+			return false
+		}
+	}
+	if outCsvName != "" {
+		logln("writing csv:", outCsvName)
+		if err := writeCsv(outCsvName, entries); err != nil {
+			fmt.Println(err)
+			return false
+		}
+	}
+	logln("complete.")
+	return true
+}
+
+func packTranslationFiles(inputName, inPoName, inXliffName, inCsvName, tmxName string, propagate bool, outYbnName, srcLang, trgLang string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	translations, err := readTranslationFiles(inPoName, inXliffName, inCsvName)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	if propagate || tmxName != "" {
+		entries, err := loadTextEntries(inputName, key, guessKey, ops, codePage)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		tm := newTranslationMemory()
+		if propagate {
+			tm.addEntries(entries, translations)
+		}
+		if tmxName != "" {
+			logln("reading tmx:", tmxName)
+			tmxMemory, err := readTmx(tmxName, srcLang, trgLang)
+			if err != nil {
+				fmt.Println(err)
+				return false
+			}
+			for _, src := range tmxMemory.Sources {
+				for _, tr := range tmxMemory.Units[src] {
+					tm.add(src, tr.Text, tr.Count)
+				}
+			}
+		}
+		tm.printInconsistencies()
+		for i := range entries {
+			entries[i].Translation = translations[entries[i].Id]
+		}
+		logf("filled %d strings from translation memory\n", tm.fillEntries(entries))
+		for _, e := range entries {
+			if e.Translation != "" {
+				translations[e.Id] = e.Translation
+			}
+		}
+	}
+	if !packTranslations(inputName, outYbnName, translations, key, guessKey, ops, codePage) {
+		return false
+	}
+	logln("complete.")
+	return true
+}
+
+// buildTranslationMemory writes the translated strings of a project to a tmx
+// file and reports strings that were translated in more than one way.
+func buildTranslationMemory(inputName, inPoName, inXliffName, inCsvName, tmxName, srcLang, trgLang string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	translations, err := readTranslationFiles(inPoName, inXliffName, inCsvName)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	entries, err := loadTextEntries(inputName, key, guessKey, ops, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	tm := newTranslationMemory()
+	tm.addEntries(entries, translations)
+	tm.printInconsistencies()
+	logf("%d source strings in translation memory\n", len(tm.Sources))
+	logln("writing tmx:", tmxName)
+	if err := writeTmx(tmxName, tm, srcLang, trgLang); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logln("complete.")
+	return true
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"github.com/regomne/eutil/codec"
+	"golang.org/x/text/width"
+	"strings"
+	"unicode"
+)
+
+type wrapConfig struct {
+	Width    int    // in half-width units, 0 disables wrapping
+	MaxLines int    // lines per message box, 0 for no limit
+	Break    string // inserted between lines
+}
+
+var gWrap wrapConfig
+
+type wrapAtom struct {
+	Text  string
+	Width int
+	Space bool // preceded by a space
+	Glue  bool // never break before this atom
+	Word  bool // may be split by characters if it is too long
+}
+
+// runeWidth returns the width of r in half-width units. For double-byte code
+// pages this is the number of bytes the engine sees.
+func runeWidth(r rune, codePage int) int {
+	if codePage != codec.UTF8 && codePage != codec.UTF8Sig {
+		return len(encodeChars(string(r), codePage, nil))
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// wrapAtoms splits a paragraph into the pieces line breaks may go between:
+// words of narrow characters, single wide characters and control sequences.
+func wrapAtoms(s string, codePage int) []wrapAtom {
+	var atoms []wrapAtom
+	space := false
+	afterControl := false
+	for _, token := range tokenizeMessage(s) {
+		if token.Kind == "byte" {
+			// an escaped character, as wide as its bytes
+			w := len(byteEscapeRegex.FindStringSubmatch(token.Text)[1]) / 2
+			atoms = append(atoms, wrapAtom{Text: token.Text, Width: w, Space: space, Glue: afterControl && !space})
+			space = false
+			afterControl = false
+			continue
+		}
+		if token.Kind != "text" {
+			// control sequences are kept in one piece and take no space
+			atoms = append(atoms, wrapAtom{Text: token.Text, Space: space, Glue: !space})
+			space = false
+			afterControl = true
+			continue
+		}
+		for _, r := range token.Text {
+			w := runeWidth(r, codePage)
+			if r == ' ' {
+				space = true
+				afterControl = false
+				continue
+			}
+			glue := afterControl && !space
+			last := len(atoms) - 1
+			if w > 1 || !unicode.IsPrint(r) {
+				atoms = append(atoms, wrapAtom{Text: string(r), Width: w, Space: space, Glue: glue})
+			} else if last >= 0 && !space && atoms[last].Word {
+				atoms[last].Text += string(r)
+				atoms[last].Width += w
+			} else {
+				atoms = append(atoms, wrapAtom{Text: string(r), Width: w, Space: space, Glue: glue, Word: true})
+			}
+			space = false
+			afterControl = false
+		}
+	}
+	return atoms
+}
+
+// wrapParagraph breaks a paragraph without line breaks into lines of at most
+// maxWidth half-width units.
+func wrapParagraph(s string, maxWidth, codePage int) []string {
+	var lines []string
+	line := ""
+	lineWidth := 0
+	newLine := func() {
+		lines = append(lines, line)
+		line = ""
+		lineWidth = 0
+	}
+	for _, atom := range wrapAtoms(s, codePage) {
+		sep := ""
+		if atom.Space && lineWidth > 0 {
+			sep = " "
+		}
+		if !atom.Glue && lineWidth > 0 && lineWidth+len(sep)+atom.Width > maxWidth {
+			newLine()
+			sep = ""
+		}
+		if atom.Word && lineWidth+atom.Width > maxWidth {
+			// too long for a whole line, split it
+			for _, r := range atom.Text {
+				w := runeWidth(r, codePage)
+				if lineWidth > 0 && lineWidth+w > maxWidth {
+					newLine()
+				}
+				line += string(r)
+				lineWidth += w
+			}
+			continue
+		}
+		line += sep + atom.Text
+		lineWidth += len(sep) + atom.Width
+	}
+	return append(lines, line)
+}
+
+// wrapMessage wraps every paragraph of a message and returns the result and
+// its number of lines. Existing breaks are kept.
+func wrapMessage(s string, cfg *wrapConfig, codePage int) (string, int) {
+	var lines []string
+	for _, paragraph := range strings.Split(s, cfg.Break) {
+		lines = append(lines, wrapParagraph(paragraph, cfg.Width, codePage)...)
+	}
+	return strings.Join(lines, cfg.Break), len(lines)
+}
+
+// wrapPackedMessage wraps a translated message for packing and warns when it
+// overflows the message box. Untranslated messages are left alone, the
+// engine wraps them by itself.
+func wrapPackedMessage(line, original, id string, codePage int) string {
+	if gWrap.Width <= 0 || line == original {
+		return line
+	}
+	wrapped, count := wrapMessage(line, &gWrap, codePage)
+	if gWrap.MaxLines > 0 && count > gWrap.MaxLines {
+		fmt.Printf("warning: %s needs %d lines, the message box fits %d\n", id, count, gWrap.MaxLines)
+	}
+	return wrapped
+}
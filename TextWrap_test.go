@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/regomne/eutil/codec"
+	"reflect"
+	"testing"
+)
+
+func TestRuneWidth(t *testing.T) {
+	tests := []struct {
+		r        rune
+		codePage int
+		want     int
+	}{
+		{'a', codec.UTF8, 1},
+		{'あ', codec.UTF8, 2},
+		{'Ａ', codec.UTF8, 2},
+		{'ｱ', codec.UTF8, 1},
+		{'a', codec.C932, 1},
+		{'あ', codec.C932, 2},
+		{'ｱ', codec.C932, 1},
+		{'é', cp1252, 1},
+	}
+	for _, tt := range tests {
+		if got := runeWidth(tt.r, tt.codePage); got != tt.want {
+			t.Errorf("runeWidth(%q, %d) = %d, want %d", tt.r, tt.codePage, got, tt.want)
+		}
+	}
+}
+
+func TestWrapParagraph(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  []string
+	}{
+		{"", 10, []string{""}},
+		{"short", 10, []string{"short"}},
+		{"the quick brown fox", 10, []string{"the quick", "brown fox"}},
+		{"the  quick", 5, []string{"the", "quick"}},
+		{"abcdefghijkl", 5, []string{"abcde", "fghij", "kl"}},
+		{"a abcdefghijkl", 5, []string{"a", "abcde", "fghij", "kl"}},
+		{"あいうえお", 4, []string{"あい", "うえ", "お"}},
+		{"ab<WAIT 500>cd ef", 4, []string{"ab<WAIT 500>cd", "ef"}},
+		{"<COLOR 255,0,0>red</COLOR> x", 3, []string{"<COLOR 255,0,0>red</COLOR>", "x"}},
+		{"ab \\x{81AD}\\x{81AD}", 4, []string{"ab", "\\x{81AD}\\x{81AD}"}},
+	}
+	for _, tt := range tests {
+		if got := wrapParagraph(tt.s, tt.width, codec.UTF8); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("wrapParagraph(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestWrapMessage(t *testing.T) {
+	cfg := wrapConfig{Width: 6, Break: "\\n"}
+	got, lines := wrapMessage("one two three\\nfour", &cfg, codec.UTF8)
+	if got != "one\\ntwo\\nthree\\nfour" || lines != 4 {
+		t.Errorf("wrapMessage = %q, %d", got, lines)
+	}
+}
+
+func TestWrapPackedMessage(t *testing.T) {
+	saved := gWrap
+	defer func() { gWrap = saved }()
+	gWrap = wrapConfig{Width: 5, Break: "\n"}
+	if got := wrapPackedMessage("aaa bbb", "aaa bbb", "id", codec.UTF8); got != "aaa bbb" {
+		t.Errorf("untranslated message was wrapped: %q", got)
+	}
+	if got := wrapPackedMessage("ccc ddd", "aaa bbb", "id", codec.UTF8); got != "ccc\nddd" {
+		t.Errorf("wrapPackedMessage = %q", got)
+	}
+	gWrap.Width = 0
+	if got := wrapPackedMessage("ccc ddd", "aaa bbb", "id", codec.UTF8); got != "ccc ddd" {
+		t.Errorf("wrapping without width: %q", got)
+	}
+}
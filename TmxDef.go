@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type tmxDoc struct {
+	XMLName xml.Name  `xml:"tmx"`
+	Version string    `xml:"version,attr"`
+	Header  tmxHeader `xml:"header"`
+	Units   []tmxUnit `xml:"body>tu"`
+}
+
+type tmxHeader struct {
+	CreationTool        string `xml:"creationtool,attr"`
+	CreationToolVersion string `xml:"creationtoolversion,attr"`
+	SegType             string `xml:"segtype,attr"`
+	OTmf                string `xml:"o-tmf,attr"`
+	AdminLang           string `xml:"adminlang,attr"`
+	SrcLang             string `xml:"srclang,attr"`
+	DataType            string `xml:"datatype,attr"`
+}
+
+type tmxUnit struct {
+	UsageCount int          `xml:"usagecount,attr,omitempty"`
+	Variants   []tmxVariant `xml:"tuv"`
+}
+
+type tmxVariant struct {
+	Lang    string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	OldLang string `xml:"lang,attr,omitempty"` // TMX 1.1 and older
+	Seg     string `xml:"seg"`
+}
+
+type tmTranslation struct {
+	Text  string
+	Count int
+}
+
+// translationMemory collects every translation seen for a source string,
+// most used first.
+type translationMemory struct {
+	Units   map[string][]tmTranslation
+	Sources []string // insertion order, for stable output
+}
+
+func newTranslationMemory() *translationMemory {
+	return &translationMemory{Units: map[string][]tmTranslation{}}
+}
+
+func (tm *translationMemory) add(src, tr string, count int) {
+	if src == "" || tr == "" {
+		return
+	}
+	trs, ok := tm.Units[src]
+	if !ok {
+		tm.Sources = append(tm.Sources, src)
+	}
+	found := false
+	for i := range trs {
+		if trs[i].Text == tr {
+			trs[i].Count += count
+			found = true
+			break
+		}
+	}
+	if !found {
+		trs = append(trs, tmTranslation{tr, count})
+	}
+	sort.SliceStable(trs, func(i, j int) bool {
+		return trs[i].Count > trs[j].Count
+	})
+	tm.Units[src] = trs
+}
+
+// lookup returns the most used translation of src.
+func (tm *translationMemory) lookup(src string) (string, bool) {
+	trs := tm.Units[src]
+	if len(trs) == 0 {
+		return "", false
+	}
+	return trs[0].Text, true
+}
+
+// inconsistent returns the sources that have more than one translation.
+func (tm *translationMemory) inconsistent() []string {
+	var srcs []string
+	for _, src := range tm.Sources {
+		if len(tm.Units[src]) > 1 {
+			srcs = append(srcs, src)
+		}
+	}
+	return srcs
+}
+
+// addEntries adds the translated entries to the memory.
+func (tm *translationMemory) addEntries(entries []textEntry, translations map[string]string) {
+	for _, e := range entries {
+		if t, ok := translations[e.Id]; ok && t != "" {
+			tm.add(e.Text, t, 1)
+		}
+	}
+}
+
+// fillEntries sets the translation of every untranslated entry whose source
+// is in the memory and returns how many were filled.
+func (tm *translationMemory) fillEntries(entries []textEntry) int {
+	filled := 0
+	for i := range entries {
+		if entries[i].Translation != "" {
+			continue
+		}
+		if t, ok := tm.lookup(entries[i].Text); ok {
+			entries[i].Translation = t
+			filled++
+		}
+	}
+	return filled
+}
+
+// printInconsistencies lists every source with differing translations.
+func (tm *translationMemory) printInconsistencies() {
+	for _, src := range tm.inconsistent() {
+		fmt.Printf("inconsistent translations for %q:\n", src)
+		for _, tr := range tm.Units[src] {
+			fmt.Printf("\t%dx %q\n", tr.Count, tr.Text)
+		}
+	}
+}
+
+func writeTmx(fileName string, tm *translationMemory, srcLang, trgLang string) error {
+	doc := tmxDoc{
+		Version: "1.4",
+		Header: tmxHeader{
+			CreationTool:        "extYuRis",
+			CreationToolVersion: "3.0",
+			SegType:             "sentence",
+			OTmf:                "extYuRis",
+			AdminLang:           "en",
+			SrcLang:             srcLang,
+			DataType:            "plaintext",
+		},
+	}
+	for _, src := range tm.Sources {
+		for _, tr := range tm.Units[src] {
+			doc.Units = append(doc.Units, tmxUnit{
+				UsageCount: tr.Count,
+				Variants: []tmxVariant{
+					{Lang: srcLang, Seg: src},
+					{Lang: trgLang, Seg: tr.Text},
+				},
+			})
+		}
+	}
+	out, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append([]byte(xml.Header), out...), os.ModePerm)
+}
+
+// tmxLangMatches compares language tags ignoring case and region, so "ja-JP"
+// matches "ja".
+func tmxLangMatches(tag, lang string) bool {
+	tag = strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	lang = strings.ToLower(lang)
+	return tag == lang || strings.HasPrefix(tag, lang+"-")
+}
+
+func readTmx(fileName, srcLang, trgLang string) (tm *translationMemory, err error) {
+	stm, err := os.ReadFile(fileName)
+	if err != nil {
+		return
+	}
+	var doc tmxDoc
+	if err = xml.Unmarshal(stm, &doc); err != nil {
+		return
+	}
+	tm = newTranslationMemory()
+	for _, unit := range doc.Units {
+		src, tr := "", ""
+		for _, v := range unit.Variants {
+			lang := v.Lang
+			if lang == "" {
+				lang = v.OldLang
+			}
+			if tmxLangMatches(lang, srcLang) {
+				src = v.Seg
+			} else if tmxLangMatches(lang, trgLang) {
+				tr = v.Seg
+			}
+		}
+		count := unit.UsageCount
+		if count == 0 {
+			count = 1
+		}
+		tm.add(src, tr, count)
+	}
+	return
+}
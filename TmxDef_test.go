@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTranslationMemory(t *testing.T) {
+	tm := newTranslationMemory()
+	tm.addEntries([]textEntry{
+		{Id: "1", Text: "hello"},
+		{Id: "2", Text: "hello"},
+		{Id: "3", Text: "hello"},
+		{Id: "4", Text: "bye"},
+		{Id: "5", Text: "untranslated"},
+	}, map[string]string{"1": "hallo", "2": "servus", "3": "servus", "4": "tschüss", "5": ""})
+	if got, ok := tm.lookup("hello"); !ok || got != "servus" {
+		t.Errorf("lookup(hello) = %q, %v, want the most used", got, ok)
+	}
+	if _, ok := tm.lookup("untranslated"); ok {
+		t.Error("lookup found an empty translation")
+	}
+	if got := tm.inconsistent(); !reflect.DeepEqual(got, []string{"hello"}) {
+		t.Errorf("inconsistent = %v", got)
+	}
+	entries := []textEntry{{Text: "hello"}, {Text: "bye", Translation: "ciao"}, {Text: "new"}}
+	if n := tm.fillEntries(entries); n != 1 || entries[0].Translation != "servus" || entries[1].Translation != "ciao" || entries[2].Translation != "" {
+		t.Errorf("fillEntries = %d, %+v", n, entries)
+	}
+}
+
+func TestTmxLangMatches(t *testing.T) {
+	tests := []struct {
+		tag, lang string
+		want      bool
+	}{
+		{"ja", "ja", true},
+		{"ja-JP", "ja", true},
+		{"JA_jp", "ja", true},
+		{"jav", "ja", false},
+		{"en", "ja", false},
+	}
+	for _, tt := range tests {
+		if got := tmxLangMatches(tt.tag, tt.lang); got != tt.want {
+			t.Errorf("tmxLangMatches(%s, %s) = %v", tt.tag, tt.lang, got)
+		}
+	}
+}
+
+func TestTmxRoundTrip(t *testing.T) {
+	tm := newTranslationMemory()
+	tm.add("a & <b>", "A & <B>", 3)
+	tm.add("a & <b>", "other", 1)
+	tm.add("line\nbreak", "Zeilen\numbruch", 1)
+	name := filepath.Join(t.TempDir(), "t.tmx")
+	if err := writeTmx(name, tm, "ja", "de"); err != nil {
+		t.Fatal(err)
+	}
+	read, err := readTmx(name, "ja", "de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, tm) {
+		t.Errorf("readTmx =\n%+v\nwant\n%+v", read, tm)
+	}
+}
+
+func TestReadTmx(t *testing.T) {
+	tmx := `<?xml version="1.0" encoding="UTF-8"?>
+<tmx version="1.1">
+	<header srclang="ja-JP"/>
+	<body>
+		<tu><tuv lang="JA-JP"><seg>old</seg></tuv><tuv lang="de-DE"><seg>alt</seg></tuv></tu>
+		<tu usagecount="2"><tuv xml:lang="ja"><seg>new</seg></tuv><tuv xml:lang="de"><seg>neu</seg></tuv><tuv xml:lang="en"><seg>new</seg></tuv></tu>
+		<tu><tuv xml:lang="ja"><seg>source only</seg></tuv></tu>
+	</body>
+</tmx>`
+	name := filepath.Join(t.TempDir(), "t.tmx")
+	os.WriteFile(name, []byte(tmx), os.ModePerm)
+	tm, err := readTmx(name, "ja", "de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &translationMemory{
+		Units: map[string][]tmTranslation{
+			"old": {{"alt", 1}},
+			"new": {{"neu", 2}},
+		},
+		Sources: []string{"old", "new"},
+	}
+	if !reflect.DeepEqual(tm, want) {
+		t.Errorf("readTmx = %+v, want %+v", tm, want)
+	}
+	os.WriteFile(name, []byte("<tmx><body>"), os.ModePerm)
+	if _, err := readTmx(name, "ja", "de"); err == nil {
+		t.Error("readTmx of a broken file succeeded")
+	}
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"fmt"
+	"github.com/regomne/eutil/codec"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// traceValue is the value of a variable while tracing.
+type traceValue struct {
+	Num   int64
+	Str   string
+	IsStr bool
+}
+
+func (v traceValue) truth() bool {
+	if v.IsStr {
+		return v.Str != ""
+	}
+	return v.Num != 0
+}
+
+func boolValue(b bool) traceValue {
+	if b {
+		return traceValue{Num: 1}
+	}
+	return traceValue{}
+}
+
+// choicePolicy picks the options of the menus met along a route: the fixed
+// answers in order, then the first or last option.
+type choicePolicy struct {
+	Answers  []int // 1-based
+	Fallback string
+}
+
+func parseChoicePolicy(s string) (policy choicePolicy, err error) {
+	policy.Fallback = "first"
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		switch part {
+		case "":
+		case "first", "last":
+			policy.Fallback = part
+		default:
+			n, e := strconv.Atoi(part)
+			if e != nil || n < 1 {
+				return policy, fmt.Errorf("bad choice: %s", part)
+			}
+			policy.Answers = append(policy.Answers, n)
+		}
+	}
+	return
+}
+
+func (p *choicePolicy) choose(options int) int {
+	if len(p.Answers) > 0 {
+		n := p.Answers[0]
+		p.Answers = p.Answers[1:]
+		if n <= options {
+			return n - 1
+		}
+		fmt.Printf("choice %d of a menu with %d options, taking the %s\n", n, options, p.Fallback)
+	}
+	if p.Fallback == "last" {
+		return options - 1
+	}
+	return 0
+}
+
+type traceScript struct {
+	Name  string
+	Info  ystbInfo
+	Menus map[int]*choiceMenu // by the instruction of the last option
+}
+
+type traceFrame struct {
+	Script *traceScript
+	Inst   int
+}
+
+type traceLoop struct {
+	Start     int
+	Remaining int // runs left, endless if negative
+}
+
+// tracer executes the scripts of a game headless and records what the player
+// sees.
+type tracer struct {
+	Scripts      map[uint32]*traceScript
+	Labels       map[string]traceFrame
+	Vars         map[string]traceValue
+	Ops          *[256]string
+	CodePage     int
+	Project      *projectInfo
+	Policy       choicePolicy
+	Translations map[string]string
+	Unsupported  map[string]int
+	Out          []string
+}
+
+// text returns the translation of a string if there is one.
+func (t *tracer) text(id, text string) string {
+	if tr := t.Translations[id]; tr != "" {
+		return tr
+	}
+	return text
+}
+
+// eval computes a postfix expression.
+func (t *tracer) eval(tokens []exprToken) (traceValue, error) {
+	var stack []traceValue
+	for i := range tokens {
+		tok := &tokens[i]
+		if !tok.isOperator() {
+			switch {
+			case tok.variable() != "":
+				stack = append(stack, t.Vars[tok.variable()])
+			case tok.Kind == 'M':
+				stack = append(stack, traceValue{Str: strings.Trim(decodeText(tok.Data, t.CodePage), `"'`), IsStr: true})
+			default:
+				n, ok := tok.intValue()
+				if !ok {
+					return traceValue{}, fmt.Errorf("unsupported token %s", tok.format(t.CodePage))
+				}
+				stack = append(stack, traceValue{Num: n})
+			}
+			continue
+		}
+		if len(stack) < 2 {
+			return traceValue{}, fmt.Errorf("operator %s without operands", tok.format(t.CodePage))
+		}
+		l, r := stack[len(stack)-2], stack[len(stack)-1]
+		stack = stack[:len(stack)-2]
+		v, err := evalOperator(tok.Kind, l, r)
+		if err != nil {
+			return traceValue{}, err
+		}
+		stack = append(stack, v)
+	}
+	if len(stack) != 1 {
+		return traceValue{}, fmt.Errorf("expression leaves %d values", len(stack))
+	}
+	return stack[0], nil
+}
+
+func evalOperator(op byte, l, r traceValue) (traceValue, error) {
+	if l.IsStr || r.IsStr {
+		switch op {
+		case '=':
+			return boolValue(l.Str == r.Str && l.IsStr == r.IsStr), nil
+		case '!':
+			return boolValue(l.Str != r.Str || l.IsStr != r.IsStr), nil
+		case '+':
+			return traceValue{Str: l.Str + r.Str, IsStr: true}, nil
+		}
+		return traceValue{}, fmt.Errorf("operator %c on strings", op)
+	}
+	a, b := l.Num, r.Num
+	switch op {
+	case '=':
+		return boolValue(a == b), nil
+	case '!':
+		return boolValue(a != b), nil
+	case '<':
+		return boolValue(a < b), nil
+	case '>':
+		return boolValue(a > b), nil
+	case '{':
+		return boolValue(a <= b), nil
+	case '}':
+		return boolValue(a >= b), nil
+	case '+':
+		return traceValue{Num: a + b}, nil
+	case '-':
+		return traceValue{Num: a - b}, nil
+	case '*':
+		return traceValue{Num: a * b}, nil
+	case '/', '%':
+		if b == 0 {
+			return traceValue{}, fmt.Errorf("division by zero")
+		}
+		if op == '/' {
+			return traceValue{Num: a / b}, nil
+		}
+		return traceValue{Num: a % b}, nil
+	case '&':
+		return traceValue{Num: a & b}, nil
+	case '|':
+		return traceValue{Num: a | b}, nil
+	case '^':
+		return traceValue{Num: a ^ b}, nil
+	case 'A':
+		return boolValue(a != 0 && b != 0), nil
+	case 'O':
+		return boolValue(a != 0 || b != 0), nil
+	}
+	return traceValue{}, fmt.Errorf("unsupported operator %c", op)
+}
+
+func (t *tracer) evalArg(arg *ystbArgInfo) (traceValue, error) {
+	tokens, err := parseExpr(ystbArgExpr(arg))
+	if err != nil {
+		return traceValue{}, err
+	}
+	return t.eval(tokens)
+}
+
+// skipBlock returns the instruction after the one closing the block that
+// starts before from: the matching ELSE or IFEND of an IF, or LOOPEND of a
+// LOOP. Nested blocks are skipped.
+func (t *tracer) skipBlock(script *traceScript, from int, open string, closes ...string) int {
+	depth := 0
+	for i := from; i < len(script.Info.Insts); i++ {
+		cmd := t.Project.commandName(script.Info.Insts[i].Op)
+		if cmd == open {
+			depth++
+			continue
+		}
+		for _, c := range closes {
+			if cmd != c {
+				continue
+			}
+			if depth == 0 {
+				return i + 1
+			}
+			if c == closes[len(closes)-1] {
+				depth--
+			}
+			break
+		}
+	}
+	return len(script.Info.Insts)
+}
+
+func (t *tracer) unsupported(what string) {
+	if t.Unsupported[what] == 0 {
+		logln("skipping unsupported:", what)
+	}
+	t.Unsupported[what]++
+}
+
+// run executes from a label until the scripts end or the step limit is hit.
+// It stops with an error at a condition it can't evaluate, as going on would
+// follow a route the game might not take.
+func (t *tracer) run(start traceFrame, maxSteps int) error {
+	pc := start
+	var calls []traceFrame
+	var loops []traceLoop
+	label := ""
+	for steps := 0; ; steps++ {
+		if steps >= maxSteps {
+			fmt.Printf("stopped after %d steps\n", maxSteps)
+			return nil
+		}
+		if pc.Inst >= len(pc.Script.Info.Insts) {
+			if len(calls) == 0 {
+				return nil
+			}
+			pc, calls = calls[len(calls)-1], calls[:len(calls)-1]
+			continue
+		}
+		if id, ok := scriptIdOfName(pc.Script.Name); ok {
+			if l := t.Project.labelAt(id, pc.Inst); l != label && l != "" {
+				label = l
+				t.Out = append(t.Out, "# "+label)
+			}
+		}
+		inst := &pc.Script.Info.Insts[pc.Inst]
+		next := pc.Inst + 1
+		switch t.Ops[inst.Op] {
+		case "msg":
+			ref := ystbTextRef{pc.Inst, 0}
+			t.Out = append(t.Out, t.text(ystbRefId(pc.Script.Name, ref), decodeText(ystbRefBytes(&pc.Script.Info, ref), t.CodePage)))
+		case "call":
+			if menu, ok := pc.Script.Menus[pc.Inst]; ok {
+				k := t.Policy.choose(len(menu.Options))
+				t.Out = append(t.Out, "> "+strings.Trim(t.text(menu.Options[k].Id, menu.Options[k].Text), `"'`))
+				if menu.Variable != "" {
+					t.Vars[menu.Variable] = traceValue{Num: int64(k) + menu.base}
+				}
+			}
+		}
+		cmd := t.Project.commandName(inst.Op)
+		switch cmd {
+		case "IF":
+			if len(inst.Args) == 0 {
+				return fmt.Errorf("%s:%d: IF without condition", pc.Script.Name, pc.Inst)
+			}
+			v, err := t.evalArg(&inst.Args[0])
+			if err != nil {
+				return fmt.Errorf("%s:%d: can't evaluate IF: %v", pc.Script.Name, pc.Inst, err)
+			}
+			if !v.truth() {
+				next = t.skipBlock(pc.Script, next, "IF", "ELSE", "IFEND")
+			}
+		case "ELSE":
+			// the IF branch was taken
+			next = t.skipBlock(pc.Script, next, "IF", "IFEND")
+		case "IFEND", "LOOPEND":
+			if cmd == "LOOPEND" && len(loops) > 0 {
+				loop := &loops[len(loops)-1]
+				if loop.Remaining != 0 {
+					loop.Remaining--
+					next = loop.Start
+					break
+				}
+				loops = loops[:len(loops)-1]
+			}
+		case "LOOP":
+			count := int64(-1)
+			if len(inst.Args) > 0 {
+				v, err := t.evalArg(&inst.Args[0])
+				if err == nil {
+					count = v.Num
+				}
+			}
+			if count == 0 {
+				next = t.skipBlock(pc.Script, next, "LOOP", "LOOPEND")
+			} else {
+				loops = append(loops, traceLoop{Start: next, Remaining: int(count - 1)})
+			}
+		case "LOOPBREAK":
+			if len(loops) > 0 {
+				loops = loops[:len(loops)-1]
+			}
+			next = t.skipBlock(pc.Script, next, "LOOP", "LOOPEND")
+		case "JUMP", "GOSUB":
+			if len(inst.Args) == 0 {
+				t.unsupported(cmd + " without label")
+				break
+			}
+			target := argLabel(&inst.Args[0], t.Project, t.CodePage)
+			to, ok := t.Labels[target]
+			if !ok {
+				t.unsupported(fmt.Sprintf("%s to unknown label %q", cmd, target))
+				break
+			}
+			if cmd == "GOSUB" {
+				calls = append(calls, traceFrame{pc.Script, next})
+			}
+			pc = to
+			continue
+		case "RETURN":
+			if len(calls) == 0 {
+				return nil
+			}
+			pc, calls = calls[len(calls)-1], calls[:len(calls)-1]
+			continue
+		case "END":
+			return nil
+		case "LET":
+			t.let(pc, inst)
+		default:
+			if op := t.Ops[inst.Op]; op != "msg" && op != "call" {
+				if cmd == "" {
+					cmd = "op " + strconv.Itoa(int(inst.Op))
+				}
+				t.unsupported(cmd)
+			}
+		}
+		pc.Inst = next
+	}
+}
+
+// let assigns the value of the second argument to the variable of the first.
+func (t *tracer) let(pc traceFrame, inst *ystbInstInfo) {
+	if len(inst.Args) < 2 {
+		t.unsupported("LET without value")
+		return
+	}
+	tokens, err := parseExpr(ystbArgExpr(&inst.Args[0]))
+	if err != nil || len(tokens) != 1 || tokens[0].variable() == "" {
+		t.unsupported("LET to something else than a variable")
+		return
+	}
+	v, err := t.evalArg(&inst.Args[1])
+	if err != nil {
+		t.unsupported(fmt.Sprintf("LET at %s:%d: %v", pc.Script.Name, pc.Inst, err))
+		return
+	}
+	t.Vars[tokens[0].variable()] = v
+}
+
+// loadTracer reads the scripts, labels and commands of a game directory.
+func loadTracer(inputName string, key []byte, guessKey bool, ops *[256]string, codePage int) (t *tracer, err error) {
+	files, err := listYbnFiles(inputName)
+	if err != nil {
+		return
+	}
+	guessProjectOps(files, key, guessKey, ops)
+	project := loadProject(inputName, codePage)
+	if len(project.Commands) == 0 {
+		return nil, fmt.Errorf("no ysc.ybn found in %s, it is needed to know the commands", inputName)
+	}
+	t = &tracer{
+		Scripts:     map[uint32]*traceScript{},
+		Labels:      map[string]traceFrame{},
+		Vars:        map[string]traceValue{},
+		Ops:         ops,
+		CodePage:    codePage,
+		Project:     project,
+		Unsupported: map[string]int{},
+	}
+	for _, file := range files {
+		id, ok := scriptIdOfName(file)
+		if !ok {
+			continue
+		}
+		stm, e := os.ReadFile(file)
+		if e != nil {
+			return nil, e
+		}
+		if ybnMagic(stm) != "YSTB" {
+			continue
+		}
+		fileKey := key
+		if guessKey {
+			fileKey = guessYstbKey(stm)
+		}
+		script := &traceScript{Name: scriptName(file), Menus: map[int]*choiceMenu{}}
+		script.Info, e = parseYstb(stm, fileKey, "")
+		if e != nil {
+			return nil, fmt.Errorf("%s: %v", file, e)
+		}
+		if !guessYstbOp(&script.Info, ops) {
+			return nil, fmt.Errorf("%s: can't guess the opcode", file)
+		}
+		menus, e := ystbChoiceMenus(&script.Info, script.Name, ops, codePage, project)
+		if e != nil {
+			return nil, fmt.Errorf("%s: %v", file, e)
+		}
+		for i := range menus {
+			script.Menus[menus[i].lastInst] = &menus[i]
+		}
+		t.Scripts[id] = script
+	}
+	for id, labels := range project.Labels {
+		if script, ok := t.Scripts[id]; ok {
+			for _, label := range labels {
+				t.Labels[label.Name] = traceFrame{script, int(label.CommandIndex)}
+			}
+		}
+	}
+	return
+}
+
+// traceRoute plays a game from a label, or the first script, choosing by the
+// policy, and writes the messages in play order. Translated text is shown
+// where the translation files have it.
+func traceRoute(inputName, startLabel, choices string, maxSteps int, outName, inPoName, inXliffName, inCsvName string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	policy, err := parseChoicePolicy(choices)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	t, err := loadTracer(inputName, key, guessKey, ops, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	t.Policy = policy
+	if t.Translations, err = readTranslationFiles(inPoName, inXliffName, inCsvName); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	for _, script := range t.Scripts {
+		var menus []choiceMenu
+		for _, menu := range script.Menus {
+			menus = append(menus, *menu)
+		}
+		if err := expandMenuTranslations(menus, t.Translations); err != nil {
+			fmt.Println(err)
+			return false
+		}
+	}
+	var start traceFrame
+	if startLabel != "" {
+		var ok bool
+		if start, ok = t.Labels[startLabel]; !ok {
+			fmt.Println("unknown label:", startLabel)
+			return false
+		}
+	} else {
+		ids := make([]int, 0, len(t.Scripts))
+		for id := range t.Scripts {
+			ids = append(ids, int(id))
+		}
+		if len(ids) == 0 {
+			fmt.Println("no scripts found in", inputName)
+			return false
+		}
+		sort.Ints(ids)
+		start = traceFrame{t.Scripts[uint32(ids[0])], 0}
+	}
+	runErr := t.run(start, maxSteps)
+	var names []string
+	for name := range t.Unsupported {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("skipped %d times: %s\n", t.Unsupported[name], name)
+	}
+	out := strings.Join(t.Out, "\r\n") + "\r\n"
+	if outName == "" {
+		fmt.Print(strings.ReplaceAll(out, "\r\n", "\n"))
+	} else {
+		logln("writing:", outName)
+		if err := os.WriteFile(outName, codec.Encode(out, codec.UTF8Sig, codec.Replace), os.ModePerm); err != nil {
+			fmt.Println(err)
+			return false
+		}
+	}
+	if runErr != nil {
+		fmt.Println("trace stopped:", runErr)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/binary"
+	"github.com/regomne/eutil/codec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exprCode encodes tokens as expression byte code.
+func exprCode(tokens ...exprToken) []byte {
+	var code []byte
+	for _, t := range tokens {
+		code = append(code, t.Kind, 0, 0)
+		binary.LittleEndian.PutUint16(code[len(code)-2:], uint16(len(t.Data)))
+		code = append(code, t.Data...)
+	}
+	return code
+}
+
+func varToken(index uint16) exprToken {
+	data := []byte{'@', 0, 0}
+	binary.LittleEndian.PutUint16(data[1:], index)
+	return exprToken{'H', data}
+}
+
+func intToken(n int32) exprToken {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, uint32(n))
+	return exprToken{'I', data}
+}
+
+func opToken(op byte) exprToken {
+	return exprToken{Kind: op}
+}
+
+func exprArg(tokens ...exprToken) ystbArgInfo {
+	return ystbArgInfo{Type: 1, Res: ystbResourceEntry{ResRaw: exprCode(tokens...)}}
+}
+
+func TestEvalOperator(t *testing.T) {
+	num := func(n int64) traceValue { return traceValue{Num: n} }
+	str := func(s string) traceValue { return traceValue{Str: s, IsStr: true} }
+	tests := []struct {
+		op   byte
+		l, r traceValue
+		want traceValue
+		ok   bool
+	}{
+		{'=', num(2), num(2), num(1), true},
+		{'!', num(2), num(2), num(0), true},
+		{'<', num(1), num(2), num(1), true},
+		{'>', num(1), num(2), num(0), true},
+		{'{', num(2), num(2), num(1), true},
+		{'}', num(1), num(2), num(0), true},
+		{'+', num(5), num(-7), num(-2), true},
+		{'-', num(5), num(7), num(-2), true},
+		{'*', num(-3), num(4), num(-12), true},
+		{'/', num(7), num(2), num(3), true},
+		{'%', num(7), num(2), num(1), true},
+		{'/', num(7), num(0), traceValue{}, false},
+		{'%', num(7), num(0), traceValue{}, false},
+		{'&', num(6), num(3), num(2), true},
+		{'|', num(6), num(3), num(7), true},
+		{'^', num(6), num(3), num(5), true},
+		{'A', num(2), num(0), num(0), true},
+		{'O', num(0), num(3), num(1), true},
+		{'=', str("a"), str("a"), num(1), true},
+		{'=', str(""), num(0), num(0), true},
+		{'!', str("a"), str("b"), num(1), true},
+		{'+', str("a"), str("b"), str("ab"), true},
+		{'<', str("a"), str("b"), traceValue{}, false},
+		{'#', num(1), num(1), traceValue{}, false},
+	}
+	for _, tt := range tests {
+		got, err := evalOperator(tt.op, tt.l, tt.r)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("evalOperator(%c, %v, %v) = %v, %v", tt.op, tt.l, tt.r, got, err)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	tr := &tracer{Vars: map[string]traceValue{"@1": {Num: 3}}, CodePage: codec.C932}
+	tests := []struct {
+		tokens []exprToken
+		want   traceValue
+		ok     bool
+	}{
+		{[]exprToken{intToken(5)}, traceValue{Num: 5}, true},
+		{[]exprToken{{'B', []byte{0xFF}}}, traceValue{Num: -1}, true},
+		{[]exprToken{varToken(1), intToken(3), opToken('=')}, traceValue{Num: 1}, true},
+		{[]exprToken{varToken(2), intToken(0), opToken('=')}, traceValue{Num: 1}, true},
+		{[]exprToken{varToken(1), intToken(2), intToken(4), opToken('*'), opToken('+')}, traceValue{Num: 11}, true},
+		{[]exprToken{{'M', []byte(`"abc"`)}}, traceValue{Str: "abc", IsStr: true}, true},
+		{[]exprToken{intToken(1), opToken('+')}, traceValue{}, false},
+		{[]exprToken{intToken(1), intToken(2)}, traceValue{}, false},
+		{[]exprToken{{'F', make([]byte, 8)}}, traceValue{}, false},
+		{[]exprToken{intToken(1), intToken(0), opToken('/')}, traceValue{}, false},
+	}
+	for _, tt := range tests {
+		got, err := tr.eval(tt.tokens)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("eval(%s) = %v, %v", formatExpr(tt.tokens, codec.C932), got, err)
+		}
+	}
+}
+
+func TestParseChoicePolicy(t *testing.T) {
+	tests := []struct {
+		s    string
+		want choicePolicy
+		ok   bool
+	}{
+		{"", choicePolicy{Fallback: "first"}, true},
+		{"2, 1,LAST", choicePolicy{Answers: []int{2, 1}, Fallback: "last"}, true},
+		{"3", choicePolicy{Answers: []int{3}, Fallback: "first"}, true},
+		{"0", choicePolicy{}, false},
+		{"x", choicePolicy{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseChoicePolicy(tt.s)
+		if (err == nil) != tt.ok || tt.ok && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseChoicePolicy(%q) = %+v, %v", tt.s, got, err)
+		}
+	}
+	policy := choicePolicy{Answers: []int{2, 5}, Fallback: "last"}
+	var got []int
+	for i := 0; i < 3; i++ {
+		got = append(got, policy.choose(3))
+	}
+	if !reflect.DeepEqual(got, []int{1, 2, 2}) {
+		t.Errorf("choose = %v", got)
+	}
+}
+
+// traceCommands are the command names of the test scripts, by opcode.
+var traceCommands = []string{"IF", "ELSE", "IFEND", "LOOP", "LOOPEND", "LOOPBREAK", "GOSUB", "RETURN", "JUMP", "LET", "WORD", "CALL", "END"}
+
+func newTestTracer(insts []ystbInstInfo) (*tracer, traceFrame) {
+	var ops [256]string
+	ops[10], ops[11] = "msg", "call"
+	script := &traceScript{Name: "test", Info: ystbInfo{Insts: insts}}
+	t := &tracer{
+		Scripts:     map[uint32]*traceScript{0: script},
+		Labels:      map[string]traceFrame{},
+		Vars:        map[string]traceValue{},
+		Ops:         &ops,
+		CodePage:    codec.C932,
+		Project:     &projectInfo{Commands: traceCommands},
+		Unsupported: map[string]int{},
+	}
+	return t, traceFrame{script, 0}
+}
+
+func TestTraceRun(t *testing.T) {
+	let := func(index uint16, n int32) ystbInstInfo {
+		return ystbInstInfo{Op: 9, Args: []ystbArgInfo{exprArg(varToken(index)), exprArg(intToken(n))}}
+	}
+	ifEq := func(index uint16, n int32) ystbInstInfo {
+		return ystbInstInfo{Op: 0, Args: []ystbArgInfo{exprArg(varToken(index), intToken(n), opToken('='))}}
+	}
+	tr, start := newTestTracer([]ystbInstInfo{
+		let(1, 2),
+		ifEq(1, 1),
+		let(2, 10),
+		{Op: 1},
+		ifEq(1, 2),
+		let(2, 20),
+		{Op: 2},
+		{Op: 2},
+		{Op: 3, Args: []ystbArgInfo{exprArg(intToken(3))}},
+		let(3, 1),
+		{Op: 4},
+		{Op: 12},
+		let(4, 1),
+	})
+	if err := tr.run(start, 100); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]traceValue{"@1": {Num: 2}, "@2": {Num: 20}, "@3": {Num: 1}}
+	if !reflect.DeepEqual(tr.Vars, want) {
+		t.Errorf("vars = %v, want %v", tr.Vars, want)
+	}
+}
+
+// TestTraceRunStopsAtUnknownCondition checks that a condition that can't be
+// evaluated stops the trace instead of being taken as false.
+func TestTraceRunStopsAtUnknownCondition(t *testing.T) {
+	tr, start := newTestTracer([]ystbInstInfo{
+		{Op: 0, Args: []ystbArgInfo{exprArg(exprToken{'F', make([]byte, 8)}, intToken(0), opToken('='))}},
+		{Op: 9, Args: []ystbArgInfo{exprArg(varToken(1)), exprArg(intToken(1))}},
+		{Op: 2},
+		{Op: 9, Args: []ystbArgInfo{exprArg(varToken(2)), exprArg(intToken(1))}},
+	})
+	err := tr.run(start, 100)
+	if err == nil || !strings.HasPrefix(err.Error(), "test:0:") {
+		t.Fatalf("run = %v, want an error at test:0", err)
+	}
+	if len(tr.Vars) != 0 {
+		t.Errorf("the trace went on after the condition: %v", tr.Vars)
+	}
+}
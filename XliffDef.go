@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+)
+
+type xliffDoc struct {
+	XMLName xml.Name    `xml:"urn:oasis:names:tc:xliff:document:2.0 xliff"`
+	Version string      `xml:"version,attr"`
+	SrcLang string      `xml:"srcLang,attr"`
+	TrgLang string      `xml:"trgLang,attr,omitempty"`
+	Files   []xliffFile `xml:"file"`
+}
+
+type xliffFile struct {
+	Id       string      `xml:"id,attr"`
+	Original string      `xml:"original,attr,omitempty"`
+	Units    []xliffUnit `xml:"unit"`
+}
+
+type xliffUnit struct {
+	Id       string         `xml:"id,attr"`
+	Notes    []xliffNote    `xml:"notes>note,omitempty"`
+	Segments []xliffSegment `xml:"segment"`
+}
+
+type xliffNote struct {
+	Category string `xml:"category,attr,omitempty"`
+	Text     string `xml:",chardata"`
+}
+
+type xliffSegment struct {
+	State  string  `xml:"state,attr,omitempty"` // initial, translated, reviewed, final
+	Source string  `xml:"source"`
+	Target *string `xml:"target"`
+}
+
+// writeXliff writes entries as XLIFF 2.0, one file element per script and one
+// unit per string. Units with a translation are marked as translated.
+func writeXliff(fileName string, entries []textEntry, srcLang, trgLang string) error {
+	doc := xliffDoc{Version: "2.0", SrcLang: srcLang, TrgLang: trgLang}
+	for _, e := range entries {
+		if len(doc.Files) == 0 || doc.Files[len(doc.Files)-1].Id != e.Script {
+			doc.Files = append(doc.Files, xliffFile{Id: e.Script, Original: e.Source})
+		}
+		file := &doc.Files[len(doc.Files)-1]
+		unit := xliffUnit{Id: e.Id}
+		kind := e.Kind
+		if e.Function != "" {
+			kind += ": " + e.Function
+		}
+		unit.Notes = append(unit.Notes, xliffNote{"kind", kind})
+		if e.Speaker != "" {
+			unit.Notes = append(unit.Notes, xliffNote{"speaker", e.Speaker})
+		}
+		if e.Label != "" {
+			unit.Notes = append(unit.Notes, xliffNote{"label", e.Label})
+		}
+		for _, note := range e.Notes {
+			unit.Notes = append(unit.Notes, xliffNote{"menu", note})
+		}
+		seg := xliffSegment{State: "initial", Source: e.Text}
+		if e.Translation != "" {
+			t := e.Translation
+			seg.State = "translated"
+			seg.Target = &t
+		}
+		unit.Segments = []xliffSegment{seg}
+		file.Units = append(file.Units, unit)
+	}
+	out, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append([]byte(xml.Header), out...), os.ModePerm)
+}
+
+func readXliff(fileName string) (doc xliffDoc, err error) {
+	stm, err := os.ReadFile(fileName)
+	if err != nil {
+		return
+	}
+	err = xml.Unmarshal(stm, &doc)
+	return
+}
+
+// xliffDoneStates are the segment states of XLIFF 2.0 after translation.
+var xliffDoneStates = map[string]bool{"translated": true, "reviewed": true, "final": true}
+
+// xliffTranslations maps unit ids to their targets. Only units whose
+// segments are all translated, reviewed or final are used.
+func xliffTranslations(doc *xliffDoc) map[string]string {
+	translations := map[string]string{}
+	for _, file := range doc.Files {
+		for _, unit := range file.Units {
+			target := ""
+			done := len(unit.Segments) > 0
+			for _, seg := range unit.Segments {
+				if !xliffDoneStates[seg.State] || seg.Target == nil {
+					done = false
+					break
+				}
+				target += *seg.Target
+			}
+			if done && target != "" {
+				translations[unit.Id] = target
+			}
+		}
+	}
+	return translations
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestXliffRoundTrip(t *testing.T) {
+	entries := []textEntry{
+		{Id: "yst00000:1:0", Script: "yst00000", Source: "start.yst", Kind: "message", Speaker: "A", Label: "START", Text: "<hello> & \"bye\"", Translation: "<hallo> & \"tschüss\""},
+		{Id: "yst00000:2:0", Script: "yst00000", Source: "start.yst", Kind: "message", Text: "untranslated"},
+		{Id: "yst00001:4:1", Script: "yst00001", Kind: "choice", Function: "es.sel.set", Text: "one\ntwo", Translation: "eins\nzwei", Notes: []string{"option 1: @1 == 1 -> UMI"}},
+	}
+	name := filepath.Join(t.TempDir(), "t.xliff")
+	if err := writeXliff(name, entries, "ja", "de"); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := readXliff(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != "2.0" || doc.SrcLang != "ja" || doc.TrgLang != "de" {
+		t.Errorf("header = %q %q %q", doc.Version, doc.SrcLang, doc.TrgLang)
+	}
+	if len(doc.Files) != 2 || doc.Files[0].Original != "start.yst" || len(doc.Files[0].Units) != 2 || len(doc.Files[1].Units) != 1 {
+		t.Fatalf("files = %+v", doc.Files)
+	}
+	wantNotes := []xliffNote{{"kind", "message"}, {"speaker", "A"}, {"label", "START"}}
+	if notes := doc.Files[0].Units[0].Notes; !reflect.DeepEqual(notes, wantNotes) {
+		t.Errorf("notes = %v, want %v", notes, wantNotes)
+	}
+	if seg := doc.Files[0].Units[1].Segments[0]; seg.State != "initial" || seg.Target != nil || seg.Source != "untranslated" {
+		t.Errorf("untranslated segment = %+v", seg)
+	}
+	want := map[string]string{"yst00000:1:0": "<hallo> & \"tschüss\"", "yst00001:4:1": "eins\nzwei"}
+	if got := xliffTranslations(&doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("xliffTranslations = %v, want %v", got, want)
+	}
+}
+
+func TestXliffTranslations(t *testing.T) {
+	xliff := `<?xml version="1.0" encoding="UTF-8"?>
+<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" version="2.0" srcLang="ja">
+	<file id="yst00000">
+		<unit id="final"><segment state="final"><source>a</source><target>A</target></segment></unit>
+		<unit id="split">
+			<segment state="translated"><source>b</source><target>B</target></segment>
+			<segment state="reviewed"><source>c</source><target>C</target></segment>
+		</unit>
+		<unit id="joined">
+			<segment state="translated"><source>d</source><target>D</target></segment>
+			<segment state="final"><source>e</source><target>E</target></segment>
+		</unit>
+		<unit id="reviewed"><segment state="reviewed"><source>i</source><target>I</target></segment></unit>
+		<unit id="initial"><segment state="initial"><source>f</source><target>F</target></segment></unit>
+		<unit id="notarget"><segment state="translated"><source>g</source></segment></unit>
+		<unit id="empty"><segment state="final"><source>h</source><target></target></segment></unit>
+	</file>
+</xliff>`
+	name := filepath.Join(t.TempDir(), "t.xliff")
+	os.WriteFile(name, []byte(xliff), os.ModePerm)
+	doc, err := readXliff(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"final": "A", "split": "BC", "joined": "DE", "reviewed": "I"}
+	if got := xliffTranslations(&doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("xliffTranslations = %v, want %v", got, want)
+	}
+}
+
+func TestReadXliffErrors(t *testing.T) {
+	for _, xliff := range []string{
+		`<xliff xmlns="urn:oasis:names:tc:xliff:document:1.2" version="1.2"></xliff>`,
+		`<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0"><file>`,
+	} {
+		name := filepath.Join(t.TempDir(), "t.xliff")
+		os.WriteFile(name, []byte(xliff), os.ModePerm)
+		if _, err := readXliff(name); err == nil {
+			t.Errorf("readXliff(%q) succeeded", xliff)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// variableUse is an instruction reading or writing a variable.
+type variableUse struct {
+	Script string
+	Inst   int
+	Label  string `json:",omitempty"`
+	Access string // read or write
+	Code   string // the instruction, like IF @1 == 2
+}
+
+// variableRefs is a variable of ysv.ybn, or one only the scripts know, with
+// its uses.
+type variableRefs struct {
+	Index    uint16
+	Names    []string // as used in expressions, like @1
+	Declared bool
+	Scope    string `json:",omitempty"` // global or static
+	ScriptId uint16 `json:",omitempty"`
+	Type     string `json:",omitempty"` // long, double or string
+	Value    any    `json:",omitempty"`
+	Uses     []variableUse
+}
+
+var ysvrScopes = map[uint8]string{1: "global", 2: "static"}
+var ysvrTypes = map[uint8]string{1: "long", 2: "double", 3: "string"}
+
+// formatInst renders an instruction with its command name and decoded
+// arguments, like LET @2 = 1.
+func formatInst(inst *ystbInstInfo, ops *[256]string, project *projectInfo, codePage int) string {
+	name := project.commandName(inst.Op)
+	if name == "" {
+		name = ops[inst.Op]
+	}
+	if name == "" {
+		name = fmt.Sprintf("op%d", inst.Op)
+	}
+	args := make([]string, len(inst.Args))
+	for i := range inst.Args {
+		arg := &inst.Args[i]
+		if arg.Type == 3 {
+			args[i] = decodeText(arg.Res.Res, codePage)
+			continue
+		}
+		tokens, err := parseExpr(ystbArgExpr(arg))
+		if err != nil {
+			args[i] = "?"
+			continue
+		}
+		args[i] = formatExpr(tokens, codePage)
+	}
+	if name == "LET" && len(args) == 2 {
+		return name + " " + args[0] + " = " + args[1]
+	}
+	if ops[inst.Op] == "call" && len(args) > 0 {
+		name, args = strings.Trim(args[0], `"`), args[1:]
+	}
+	return strings.TrimSpace(name + " " + strings.Join(args, ", "))
+}
+
+// ystbVariableUses adds the variables referenced by the expressions of a
+// script to refs. The variable LET assigns to, the first one of its first
+// argument, is written; the others there, like the index of an array
+// element, and everything else are read.
+func ystbVariableUses(script *ystbInfo, name string, ops *[256]string, codePage int, project *projectInfo, refs map[uint16]*variableRefs) {
+	scriptId, hasId := scriptIdOfName(name)
+	for i := range script.Insts {
+		inst := &script.Insts[i]
+		if ops[inst.Op] == "msg" {
+			continue
+		}
+		cmd := project.commandName(inst.Op)
+		code := ""
+		for j := range inst.Args {
+			arg := &inst.Args[j]
+			if arg.Type == 3 {
+				continue
+			}
+			tokens, err := parseExpr(ystbArgExpr(arg))
+			if err != nil {
+				continue
+			}
+			type access struct {
+				Index uint16
+				Write bool
+			}
+			assigned := cmd == "LET" && j == 0
+			seen := map[access]bool{}
+			for k := range tokens {
+				index, ok := tokens[k].varIndex()
+				if !ok {
+					continue
+				}
+				key := access{index, assigned}
+				assigned = false
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				ref, ok := refs[index]
+				if !ok {
+					ref = &variableRefs{Index: index}
+					refs[index] = ref
+				}
+				addVariableName(ref, tokens[k].variable())
+				if code == "" {
+					code = formatInst(inst, ops, project, codePage)
+				}
+				use := variableUse{Script: name, Inst: i, Access: "read", Code: code}
+				if key.Write {
+					use.Access = "write"
+				}
+				if hasId {
+					use.Label = project.labelAt(scriptId, i)
+				}
+				ref.Uses = append(ref.Uses, use)
+			}
+		}
+	}
+}
+
+func addVariableName(ref *variableRefs, name string) {
+	for _, n := range ref.Names {
+		if n == name {
+			return
+		}
+	}
+	ref.Names = append(ref.Names, name)
+}
+
+// loadVariableRefs reads the variables of ysv.ybn and their uses in the
+// scripts of a game directory, ordered by index.
+func loadVariableRefs(inputName string, key []byte, guessKey bool, ops *[256]string, codePage int) (vars []*variableRefs, err error) {
+	files, err := listYbnFiles(inputName)
+	if err != nil {
+		return
+	}
+	guessProjectOps(files, key, guessKey, ops)
+	project := loadProject(inputName, codePage)
+	if len(project.Commands) == 0 {
+		fmt.Println("no ysc.ybn found, reads and writes can't be told apart")
+	}
+	refs := map[uint16]*variableRefs{}
+	for _, file := range files {
+		stm, e := os.ReadFile(file)
+		if e != nil {
+			return nil, e
+		}
+		switch ybnMagic(stm) {
+		case "YSVR":
+			logln("loading variables:", file)
+			vr, e := parseYsvr(stm, codePage)
+			if e != nil {
+				return nil, fmt.Errorf("%s: %v", file, e)
+			}
+			for _, v := range vr.Data {
+				ref, ok := refs[v.Header.VarIndex]
+				if !ok {
+					ref = &variableRefs{Index: v.Header.VarIndex}
+					refs[v.Header.VarIndex] = ref
+				}
+				ref.Declared = true
+				ref.Scope = ysvrScopes[v.Header.Scope]
+				ref.ScriptId = v.Header.ScriptId
+				ref.Type = ysvrTypes[v.Header.Type]
+				ref.Value = v.Data
+			}
+		case "YSTB":
+			fileKey := key
+			if guessKey {
+				fileKey = guessYstbKey(stm)
+			}
+			script, e := parseYstb(stm, fileKey, "")
+			if e != nil {
+				return nil, fmt.Errorf("%s: %v", file, e)
+			}
+			if !guessYstbOp(&script, ops) {
+				return nil, fmt.Errorf("%s: can't guess the opcode", file)
+			}
+			ystbVariableUses(&script, scriptName(file), ops, codePage, project, refs)
+		}
+	}
+	for _, ref := range refs {
+		vars = append(vars, ref)
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Index < vars[j].Index
+	})
+	return
+}
+
+func (ref *variableRefs) String() string {
+	name := strings.Join(ref.Names, " ")
+	if name == "" {
+		name = fmt.Sprintf("#%d", ref.Index)
+	}
+	if !ref.Declared {
+		return name + " (not in ysv.ybn)"
+	}
+	s := fmt.Sprintf("%s %s %s = %v", name, ref.Scope, ref.Type, ref.Value)
+	if ref.Scope == "static" {
+		s += fmt.Sprintf(" (script %d)", ref.ScriptId)
+	}
+	return s
+}
+
+// writeVariableRefs lists every variable of a game with the instructions
+// reading and writing it, as text or json depending on the extension of
+// outName, or on the console without one.
+func writeVariableRefs(inputName, outName string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	vars, err := loadVariableRefs(inputName, key, guessKey, ops, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	var out []byte
+	if strings.ToLower(filepath.Ext(outName)) == ".json" {
+		if out, err = json.MarshalIndent(vars, "", "\t"); err != nil {
+			fmt.Println("error when marshalling json:", err)
+			return false
+		}
+	} else {
+		var sb strings.Builder
+		for _, ref := range vars {
+			sb.WriteString(ref.String() + "\n")
+			if len(ref.Uses) == 0 {
+				sb.WriteString("\tunused\n")
+			}
+			for _, use := range ref.Uses {
+				fmt.Fprintf(&sb, "\t%s\t%s:%d\t%s\t%s\n", use.Access, use.Script, use.Inst, use.Label, use.Code)
+			}
+		}
+		out = []byte(sb.String())
+	}
+	if outName == "" {
+		fmt.Print(string(out))
+		return true
+	}
+	logln("writing:", outName)
+	if err := os.WriteFile(outName, out, os.ModePerm); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/regomne/eutil/codec"
+	"testing"
+)
+
+func TestYstbVariableUses(t *testing.T) {
+	var ops [256]string
+	ops[10], ops[11] = "msg", "call"
+	project := &projectInfo{Commands: traceCommands}
+	script := ystbInfo{Insts: []ystbInstInfo{
+		// LET @1[@2] = @3
+		{Op: 9, Args: []ystbArgInfo{exprArg(varToken(1), varToken(2)), exprArg(varToken(3))}},
+		// LET @2 = @2 + 1
+		{Op: 9, Args: []ystbArgInfo{exprArg(varToken(2)), exprArg(varToken(2), intToken(1), opToken('+'))}},
+		// IF @1 == 1
+		{Op: 0, Args: []ystbArgInfo{exprArg(varToken(1), intToken(1), opToken('='))}},
+	}}
+	refs := map[uint16]*variableRefs{}
+	ystbVariableUses(&script, "yst00000", &ops, codec.C932, project, refs)
+	want := map[uint16][]string{
+		1: {"0 write", "2 read"},
+		2: {"0 read", "1 write", "1 read"},
+		3: {"0 read"},
+	}
+	if len(refs) != len(want) {
+		t.Fatalf("found %d variables, want %d", len(refs), len(want))
+	}
+	for index, uses := range want {
+		ref := refs[index]
+		if ref == nil || len(ref.Uses) != len(uses) {
+			t.Errorf("@%d: uses %+v, want %v", index, ref, uses)
+			continue
+		}
+		for i, use := range ref.Uses {
+			if got := string(rune('0'+use.Inst)) + " " + use.Access; got != uses[i] {
+				t.Errorf("@%d: use %d is %s, want %s", index, i, got, uses[i])
+			}
+		}
+	}
+	if code := refs[2].Uses[1].Code; code != "LET @2 = @2 + 1" {
+		t.Errorf("code = %q", code)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
-	"github.com/regomne/eutil/codec"
 	"io"
 	"os"
 )
@@ -35,21 +34,20 @@ func readFileToString(fileName string, codePage int) (s string, err error) {
 		err = readErr
 		return
 	}
-	s = codec.Decode(fileBytes, codePage)
+	s = decodeText(fileBytes, codePage)
 	return
 }
 
 func readAnsiStr(r io.Reader, codePage int) string {
 	var bf bytes.Buffer
 	var b byte
-	binary.Read(r, binary.LittleEndian, &b)
-	for b != 0 {
+	// a truncated string ends with the file
+	for binary.Read(r, binary.LittleEndian, &b) == nil && b != 0 {
 		bf.WriteByte(b)
-		binary.Read(r, binary.LittleEndian, &b)
 	}
 	buffer := bf.Bytes()
 	if len(buffer) == 0 {
 		return ""
 	}
-	return codec.Decode(buffer, codePage)
+	return decodeText(buffer, codePage)
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/regomne/eutil/codec"
+)
+
+// testYbnVersion is the version of the ybn files built by the tests.
+const testYbnVersion = 0x1D4
+
+// le encodes values in little endian, strings as Shift-JIS.
+func le(values ...any) []byte {
+	var bf bytes.Buffer
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			v = encodeText(s, codec.C932)
+		}
+		if err := binary.Write(&bf, binary.LittleEndian, v); err != nil {
+			panic(fmt.Sprintf("can't encode %#v: %v", v, err))
+		}
+	}
+	return bf.Bytes()
+}
+
+// ybnBytes encodes a ybn file with its header and the fields that follow.
+func ybnBytes(magic string, fields ...any) []byte {
+	header := GenericHeader{Version: testYbnVersion}
+	copy(header.Magic[:], magic)
+	return le(append([]any{header}, fields...)...)
+}
@@ -6,7 +6,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"github.com/aviddiviner/go-murmur"
-	"github.com/regomne/eutil/codec"
 	"hash/adler32"
 	"hash/crc32"
 	"io"
@@ -79,7 +78,7 @@ func parseYpf(oriStm []byte, codePage int) (archive ypfInfo, err error) {
 		for j := 0; j < int(b2); j++ {
 			array[j] = (^array[j]) ^ fileNameEncryptionKey
 		}
-		entry.FileName = codec.Decode(array, codePage)
+		entry.FileName = decodeText(array, codePage)
 		if entry.NameChecksum != checksumByVersion(array, header.Meta.Version, true) {
 			err = fmt.Errorf("name check failed for %s", entry.FileName)
 			return
@@ -321,7 +320,7 @@ func packYpf(outputYpf, inputDir string, version, codePage int) bool {
 
 	for _, entry := range entries {
 		binary.Write(&fullBuff, binary.LittleEndian, entry.NameChecksum)
-		encodedName := codec.Encode(entry.FileName, codePage, codec.Replace)
+		encodedName := encodeText(entry.FileName, codePage)
 		if len(encodedName) > 0xFF {
 			fmt.Println("Filename can only be one byte")
 			return false
@@ -5,7 +5,6 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"github.com/regomne/eutil/codec"
 	"os"
 	"regexp"
 	"strconv"
@@ -94,7 +93,7 @@ func parseYscf(oriStm []byte, codePage int) (script yscfInfo, err error) {
 	}
 	captionBytes := make([]byte, script.Header.CaptionLength)
 	stm.Read(captionBytes)
-	script.Caption = codec.Decode(captionBytes, codePage)
+	script.Caption = decodeText(captionBytes, codePage)
 	return
 }
 
@@ -233,7 +232,7 @@ func packYscfFile(oriStm []byte, outInstructName, outYbnName string, codePage in
 		}
 		var buffer bytes.Buffer
 		binary.Write(&buffer, binary.LittleEndian, script.Header)
-		buffer.Write(codec.Encode(script.Caption, codePage, codec.Replace))
+		buffer.Write(encodeText(script.Caption, codePage))
 		os.WriteFile(outYbnName, buffer.Bytes(), os.ModePerm)
 	}
 	logln("complete.")
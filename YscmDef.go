@@ -46,6 +46,11 @@ func parseYscm(oriStm []byte, codePage int) (script yscmInfo, err error) {
 		err = fmt.Errorf("not a ybn file")
 		return
 	}
+	// a command is at least an empty name and its action count
+	if int64(script.Header.Count) > int64(stm.Len()/2) {
+		err = fmt.Errorf("%d commands exceed the file", script.Header.Count)
+		return
+	}
 	script.Commands = make([]yscmCommandInfo, script.Header.Count)
 	for i := 0; i < int(script.Header.Count); i++ {
 		cmd := &script.Commands[i]
@@ -120,6 +125,17 @@ func parseYscmFile(oriStm []byte, outJsonName, outTxtName, outInstructName strin
 	return true
 }
 
+func packTxtToYscm(script *yscmInfo, stm []byte, txt []string, codePage int) []byte {
+	var buffer bytes.Buffer
+	buffer.Write(stm[:script.ErrorOffset])
+	for i := range txt {
+		buffer.Write(encodeText(txt[i], codePage))
+		buffer.WriteByte(0)
+	}
+	buffer.Write(script.Unk)
+	return buffer.Bytes()
+}
+
 func packYscmFile(oriStm []byte, outTxtName, outYbnName string, codePage int) bool {
 	logln("parsing ybn...")
 	script, err := parseYscm(oriStm, codePage)
@@ -135,14 +151,7 @@ func packYscmFile(oriStm []byte, outTxtName, outYbnName string, codePage int) bo
 			return false
 		}
 		logln("encoding text and writing...")
-		var buffer bytes.Buffer
-		buffer.Write(oriStm[:script.ErrorOffset])
-		for i := range ls {
-			buffer.Write(codec.Encode(ls[i], codePage, codec.Replace))
-			buffer.WriteByte(0)
-		}
-		buffer.Write(script.Unk)
-		os.WriteFile(outYbnName, buffer.Bytes(), os.ModePerm)
+		os.WriteFile(outYbnName, packTxtToYscm(&script, oriStm, ls, codePage), os.ModePerm)
 	}
 	logln("complete.")
 	return true
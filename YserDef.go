@@ -5,7 +5,6 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"github.com/regomne/eutil/codec"
 	"os"
 	"regexp"
 	"strconv"
@@ -76,6 +75,17 @@ func parseYser(oriStm []byte, codePage int) (script yserInfo, err error) {
 	return
 }
 
+func packTxtToYser(script *yserInfo, stm []byte, msgs []yserErrorMessage, codePage int) []byte {
+	var buffer bytes.Buffer
+	buffer.Write(stm[:binary.Size(script.Header)])
+	for i := range msgs {
+		binary.Write(&buffer, binary.LittleEndian, msgs[i].Code)
+		buffer.Write(encodeText(msgs[i].Message, codePage))
+		buffer.WriteByte(0)
+	}
+	return buffer.Bytes()
+}
+
 func packYserFile(oriStm []byte, outTxtName, outYbnName string, codePage int) bool {
 	logln("parsing ybn...")
 	script, err := parseYser(oriStm, codePage)
@@ -91,26 +101,24 @@ func packYserFile(oriStm []byte, outTxtName, outYbnName string, codePage int) bo
 			return false
 		}
 		logln("encoding text and writing...")
-		var buffer bytes.Buffer
-		buffer.Write(oriStm[:binary.Size(script.Header)])
 		reg, err := regexp.Compile("(?:^|\\n)([0-9]+)->\"([^\"]+)\"")
 		if err != nil {
 			fmt.Println(err)
 			return false
 		}
 		matches := reg.FindAllStringSubmatch(txt, -1)
+		msgs := make([]yserErrorMessage, len(matches))
 		for i := range matches {
 			var code, err = strconv.Atoi(matches[i][1])
 			if err != nil {
 				fmt.Println(err)
 				return false
 			}
-			binary.Write(&buffer, binary.LittleEndian, uint32(code))
-			buffer.Write(codec.Encode(matches[i][2], codePage, codec.Replace))
+			msgs[i].Code = uint32(code)
+			msgs[i].Message = matches[i][2]
 			fmt.Println(code, matches[i][2])
-			buffer.WriteByte(0)
 		}
-		os.WriteFile(outYbnName, buffer.Bytes(), os.ModePerm)
+		os.WriteFile(outYbnName, packTxtToYser(&script, oriStm, msgs, codePage), os.ModePerm)
 	}
 	logln("complete.")
 	return true
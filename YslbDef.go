@@ -5,8 +5,13 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"github.com/regomne/eutil/codec"
+	"github.com/aviddiviner/go-murmur"
+	"hash/adler32"
+	"hash/crc32"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -60,6 +65,10 @@ func parseYslbFile(oriStm []byte, outJsonName, outInstructName string, codePage
 	return true
 }
 
+// yslbLabelMinSize is the size of a label with an empty name, to reject
+// counts larger than the file before allocating them.
+const yslbLabelMinSize = 1 + 4 + 4 + 2 + 2
+
 func parseYslb(oriStm []byte, codePage int) (script yslbInfo, err error) {
 	stm := bytes.NewReader(oriStm)
 	binary.Read(stm, binary.LittleEndian, &script.Header)
@@ -69,7 +78,14 @@ func parseYslb(oriStm []byte, codePage int) (script yslbInfo, err error) {
 		err = fmt.Errorf("not a ybn file")
 		return
 	}
-	binary.Read(stm, binary.LittleEndian, &script.labelRangeStartIndexes)
+	if err = binary.Read(stm, binary.LittleEndian, &script.labelRangeStartIndexes); err != nil {
+		err = fmt.Errorf("label range index truncated")
+		return
+	}
+	if int64(script.Header.Count) > int64(stm.Len()/yslbLabelMinSize) {
+		err = fmt.Errorf("%d labels exceed the file", script.Header.Count)
+		return
+	}
 	script.Labels = make([]yslbLabel, script.Header.Count)
 	for i := 0; i < int(script.Header.Count); i++ {
 		label := &script.Labels[i]
@@ -77,7 +93,7 @@ func parseYslb(oriStm []byte, codePage int) (script yslbInfo, err error) {
 		binary.Read(stm, binary.LittleEndian, &nameLength)
 		label.EncodedName = make([]byte, nameLength)
 		stm.Read(label.EncodedName)
-		label.Name = codec.Decode(label.EncodedName, codePage)
+		label.Name = decodeText(label.EncodedName, codePage)
 		binary.Read(stm, binary.LittleEndian, &label.Id)
 		binary.Read(stm, binary.LittleEndian, &label.CommandIndex)
 		binary.Read(stm, binary.LittleEndian, &label.ScriptId)
@@ -85,3 +101,216 @@ func parseYslb(oriStm []byte, codePage int) (script yslbInfo, err error) {
 	}
 	return
 }
+
+var yslbInstructRegex = regexp.MustCompile(`^#="(.*)" =>yst(\d+)\.ybn\.instruct:\s*(\d+)$`)
+
+// readYslbInstruct reads labels from an instruct file. Instruct files have no
+// label ids, they are taken from the labels of the same name in script and
+// left 0 for new ones.
+func readYslbInstruct(instructName string, script *yslbInfo) (labels []yslbLabel, err error) {
+	stm, err := os.ReadFile(instructName)
+	if err != nil {
+		return
+	}
+	known := map[string]*yslbLabel{}
+	for i := range script.Labels {
+		known[script.Labels[i].Name] = &script.Labels[i]
+	}
+	for n, line := range strings.Split(string(bytes.TrimPrefix(stm, []byte("\ufeff"))), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		m := yslbInstructRegex.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: not a label: %s", n+1, line)
+		}
+		scriptId, e1 := strconv.ParseUint(m[2], 10, 16)
+		commandIndex, e2 := strconv.ParseUint(m[3], 10, 32)
+		if e1 != nil || e2 != nil {
+			return nil, fmt.Errorf("line %d: bad script or instruction: %s", n+1, line)
+		}
+		label := yslbLabel{
+			Name:         m[1],
+			CommandIndex: uint32(commandIndex),
+			ScriptId:     uint16(scriptId),
+		}
+		if old, ok := known[m[1]]; ok {
+			label.Id, label.Padding = old.Id, old.Padding
+		}
+		labels = append(labels, label)
+	}
+	return
+}
+
+// packYslb sorts the labels by id, encodes their names and rebuilds the
+// range index.
+func packYslb(script *yslbInfo, codePage int) ([]byte, error) {
+	labels := script.Labels
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i].Id < labels[j].Id
+	})
+	for i := range labels {
+		labels[i].EncodedName = encodeText(labels[i].Name, codePage)
+		if len(labels[i].EncodedName) > 0xFF {
+			return nil, fmt.Errorf("label %s: name of %d bytes is too long", labels[i].Name, len(labels[i].EncodedName))
+		}
+		if i > 0 && labels[i].Id == labels[i-1].Id {
+			return nil, fmt.Errorf("labels %s and %s have the same id 0x%08X", labels[i-1].Name, labels[i].Name, labels[i].Id)
+		}
+	}
+	next := 0
+	for n := range script.labelRangeStartIndexes {
+		for next < len(labels) && labels[next].Id < uint32(n)<<24 {
+			next++
+		}
+		script.labelRangeStartIndexes[n] = uint32(next)
+	}
+	header := script.Header
+	copy(header.Meta.Magic[:], "YSLB")
+	header.Count = uint32(len(labels))
+	var bf bytes.Buffer
+	binary.Write(&bf, binary.LittleEndian, &header)
+	binary.Write(&bf, binary.LittleEndian, &script.labelRangeStartIndexes)
+	for i := range labels {
+		label := &labels[i]
+		bf.WriteByte(uint8(len(label.EncodedName)))
+		bf.Write(label.EncodedName)
+		binary.Write(&bf, binary.LittleEndian, label.Id)
+		binary.Write(&bf, binary.LittleEndian, label.CommandIndex)
+		binary.Write(&bf, binary.LittleEndian, label.ScriptId)
+		binary.Write(&bf, binary.LittleEndian, label.Padding)
+	}
+	return bf.Bytes(), nil
+}
+
+// packYslbFile packs ysl.ybn from json, or from instruct with the ids of the
+// original labels.
+func packYslbFile(oriStm []byte, inJsonName, inInstructName, outYbnName string, codePage int) bool {
+	logln("parsing ybn...")
+	script, err := parseYslb(oriStm, codePage)
+	if err != nil {
+		fmt.Println("parse error:", err)
+		return false
+	}
+	original := append([]yslbLabel(nil), script.Labels...)
+	if inJsonName != "" {
+		logln("reading json:", inJsonName)
+		stm, err := os.ReadFile(inJsonName)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		var labels yslbInfo
+		if err := json.Unmarshal(stm, &labels); err != nil {
+			fmt.Println("error when parsing json:", err)
+			return false
+		}
+		script.Labels = labels.Labels
+	} else {
+		logln("reading instruct:", inInstructName)
+		script.Labels, err = readYslbInstruct(inInstructName, &script)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+	}
+	if err := assignLabelIds(&script, original, codePage); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	newStm, err := packYslb(&script, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logln("writing ybn:", outYbnName)
+	os.WriteFile(outYbnName, newStm, os.ModePerm)
+	logln("complete.")
+	return true
+}
+
+// labelIdFuncs are the ways a label id may be derived from its encoded name,
+// the hashes the engine uses for the names in ypf archives.
+var labelIdFuncs = []struct {
+	Name string
+	Func func(name []byte) uint32
+}{
+	{"murmur2", func(name []byte) uint32 { return murmur.MurmurHash2(name, 0) }},
+	{"crc32", crc32.ChecksumIEEE},
+	{"adler32", adler32.Checksum},
+}
+
+// labelIdFunc returns the derivation matching the most labels, nil if none
+// matches any.
+func labelIdFunc(labels []yslbLabel) (name string, f func([]byte) uint32, matched int) {
+	for _, c := range labelIdFuncs {
+		n := 0
+		for i := range labels {
+			if c.Func(labels[i].EncodedName) == labels[i].Id {
+				n++
+			}
+		}
+		if n > matched {
+			name, f, matched = c.Name, c.Func, n
+		}
+	}
+	return
+}
+
+// assignLabelIds computes the ids of the labels without one from their
+// names, with the derivation all ids of the original labels follow. Ids that
+// are given are kept, those not following the derivation are reported.
+func assignLabelIds(script *yslbInfo, original []yslbLabel, codePage int) error {
+	for i := range script.Labels {
+		script.Labels[i].EncodedName = encodeText(script.Labels[i].Name, codePage)
+	}
+	name, f, matched := labelIdFunc(original)
+	if matched == 0 || matched != len(original) {
+		f = nil
+	}
+	for i := range script.Labels {
+		label := &script.Labels[i]
+		if f == nil {
+			if label.Id == 0 {
+				return fmt.Errorf("label %s has no id and the ids of the original labels don't follow a known derivation", label.Name)
+			}
+			continue
+		}
+		if id := f(label.EncodedName); label.Id == 0 {
+			logf("label %s: id 0x%08X from %s\n", label.Name, id, name)
+			label.Id = id
+		} else if label.Id != id {
+			fmt.Printf("label %s: id 0x%08X doesn't match its name, %s gives 0x%08X\n", label.Name, label.Id, name, id)
+		}
+	}
+	return nil
+}
+
+// verifyLabelIds prints the derivation the ids of a ysl.ybn follow and the
+// labels whose ids don't.
+func verifyLabelIds(ybnName string, codePage int) bool {
+	stm, err := os.ReadFile(ybnName)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	script, err := parseYslb(stm, codePage)
+	if err != nil {
+		fmt.Println("parse error:", err)
+		return false
+	}
+	name, f, matched := labelIdFunc(script.Labels)
+	if f == nil {
+		fmt.Printf("none of %d label ids match a known derivation\n", len(script.Labels))
+		return false
+	}
+	fmt.Printf("%d of %d label ids match %s\n", matched, len(script.Labels), name)
+	for i := range script.Labels {
+		label := &script.Labels[i]
+		if id := f(label.EncodedName); id != label.Id {
+			fmt.Printf("mismatch: %s: id 0x%08X, computed 0x%08X\n", label.Name, label.Id, id)
+		}
+	}
+	return matched == len(script.Labels)
+}
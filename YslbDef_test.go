@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/aviddiviner/go-murmur"
+	"github.com/regomne/eutil/codec"
+	"hash/crc32"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// yslbBytes encodes a YSLB file with labels already sorted by id.
+func yslbBytes(labels ...yslbLabel) []byte {
+	var index [256]uint32
+	for n := range index {
+		for index[n] < uint32(len(labels)) && labels[index[n]].Id>>24 < uint32(n) {
+			index[n]++
+		}
+	}
+	fields := []any{uint32(len(labels)), index}
+	for _, label := range labels {
+		name := encodeText(label.Name, codec.C932)
+		fields = append(fields, uint8(len(name)), name, label.Id, label.CommandIndex, label.ScriptId, label.Padding)
+	}
+	return ybnBytes("YSLB", fields...)
+}
+
+func murmurLabel(name string, commandIndex uint32, scriptId uint16) yslbLabel {
+	id := murmur.MurmurHash2(encodeText(name, codec.C932), 0)
+	return yslbLabel{Name: name, Id: id, CommandIndex: commandIndex, ScriptId: scriptId, Padding: [2]byte{0xCD, 0xCD}}
+}
+
+// testYslb is a ysl.ybn whose ids are the murmur2 hashes of the names. It is
+// built here, not taken from a game.
+func testYslb() []byte {
+	labels := []yslbLabel{
+		murmurLabel("es.INIT", 0, 0),
+		murmurLabel("start", 12, 1),
+		murmurLabel("あの日", 40, 1),
+		murmurLabel("end", 3, 2),
+		murmurLabel("choice_1a", 77, 2),
+	}
+	for i := 1; i < len(labels); i++ {
+		for j := i; j > 0 && labels[j].Id < labels[j-1].Id; j-- {
+			labels[j], labels[j-1] = labels[j-1], labels[j]
+		}
+	}
+	return yslbBytes(labels...)
+}
+
+func TestPackYslbFromJson(t *testing.T) {
+	stm := testYslb()
+	script, err := parseYslb(stm, codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := append([]yslbLabel(nil), script.Labels...)
+	out, err := json.Marshal(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels yslbInfo
+	if err := json.Unmarshal(out, &labels); err != nil {
+		t.Fatal(err)
+	}
+	// the order of the json doesn't matter
+	script.Labels = append(labels.Labels[2:], labels.Labels[:2]...)
+	if err := assignLabelIds(&script, original, codec.C932); err != nil {
+		t.Fatal(err)
+	}
+	newStm, err := packYslb(&script, codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(newStm, stm) {
+		t.Errorf("packed\n% x\nwant\n% x", newStm, stm)
+	}
+}
+
+func TestPackYslbFromInstruct(t *testing.T) {
+	stm := testYslb()
+	instructName := filepath.Join(t.TempDir(), "ysl.ybn.instruct")
+	if !parseYslbFile(stm, "", instructName, codec.C932) {
+		t.Fatal("parseYslbFile failed")
+	}
+	script, err := parseYslb(stm, codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := append([]yslbLabel(nil), script.Labels...)
+	if script.Labels, err = readYslbInstruct(instructName, &script); err != nil {
+		t.Fatal(err)
+	}
+	if err := assignLabelIds(&script, original, codec.C932); err != nil {
+		t.Fatal(err)
+	}
+	newStm, err := packYslb(&script, codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(newStm, stm) {
+		t.Errorf("packed\n% x\nwant\n% x", newStm, stm)
+	}
+}
+
+func TestLabelIdFunc(t *testing.T) {
+	for _, c := range labelIdFuncs {
+		var labels []yslbLabel
+		for _, name := range []string{"start", "あの日", "end"} {
+			encoded := encodeText(name, codec.C932)
+			labels = append(labels, yslbLabel{EncodedName: encoded, Name: name, Id: c.Func(encoded)})
+		}
+		labels[2].Id++
+		name, f, matched := labelIdFunc(labels)
+		if name != c.Name || f == nil || matched != 2 {
+			t.Errorf("%s: labelIdFunc = %s, %d matched", c.Name, name, matched)
+		}
+	}
+	labels := []yslbLabel{{EncodedName: []byte("start"), Id: 1}}
+	if name, f, matched := labelIdFunc(labels); f != nil || matched != 0 {
+		t.Errorf("labelIdFunc = %s, %d matched, want none", name, matched)
+	}
+}
+
+func TestAssignLabelIds(t *testing.T) {
+	script, err := parseYslb(testYslb(), codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := script.Labels
+	script.Labels = []yslbLabel{
+		{Name: "start", Id: 5},
+		{Name: "新しい"},
+	}
+	if err := assignLabelIds(&script, original, codec.C932); err != nil {
+		t.Fatal(err)
+	}
+	if script.Labels[0].Id != 5 {
+		t.Errorf("the given id of start was replaced by 0x%08X", script.Labels[0].Id)
+	}
+	if want := murmur.MurmurHash2(encodeText("新しい", codec.C932), 0); script.Labels[1].Id != want {
+		t.Errorf("new label got id 0x%08X, want 0x%08X", script.Labels[1].Id, want)
+	}
+
+	// a single id not following the derivation means it can't be trusted
+	original = append([]yslbLabel(nil), original...)
+	original[0].Id = crc32.ChecksumIEEE(original[0].EncodedName)
+	script.Labels = []yslbLabel{{Name: "start", Id: 5}}
+	if err := assignLabelIds(&script, original, codec.C932); err != nil {
+		t.Errorf("labels with ids failed: %v", err)
+	}
+	script.Labels = []yslbLabel{{Name: "新しい"}}
+	err = assignLabelIds(&script, original, codec.C932)
+	if err == nil || !strings.Contains(err.Error(), "新しい") {
+		t.Errorf("assignLabelIds = %v, want an error for the new label", err)
+	}
+	script.Labels = []yslbLabel{{Name: "新しい"}}
+	if err := assignLabelIds(&script, nil, codec.C932); err == nil {
+		t.Error("assignLabelIds derived an id without any original label")
+	}
+}
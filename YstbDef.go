@@ -72,7 +72,7 @@ type ystbResInfo struct {
 }
 
 func GetTextFunctionNames() []string {
-	return []string{
+	names := []string{
 		`"es.sel.set"`,
 		`"es.char.name.mark.set"`,
 		`"es.char.name"`,
@@ -80,6 +80,10 @@ func GetTextFunctionNames() []string {
 		`"es.tips.def.set"`,
 		`"es.tips.tx.def.set"`,
 	}
+	for _, f := range gProfile.TextFunctions {
+		names = append(names, quotedFunctionName(f))
+	}
+	return names
 }
 
 func isLongEnglishSentence(s []byte) bool {
@@ -146,6 +150,21 @@ func guessYstbOp(script *ystbInfo, ops *[256]string) bool {
 	return false
 }
 
+// guessYstbKey derives the key from the last instruction of the code section,
+// which is the same in standard compiled scripts.
+func guessYstbKey(oriStm []byte) []byte {
+	var header ystbHeader
+	binary.Read(bytes.NewReader(oriStm), binary.LittleEndian, &header)
+	guessedKey := [4]byte{}
+	id := binary.Size(header) + int(header.CodeSize) - 4
+	guessedKey[0] = oriStm[id]
+	guessedKey[1] = oriStm[id+1]
+	guessedKey[2] = oriStm[id+2]
+	guessedKey[3] = oriStm[id+3]
+	decryptBlock(guessedKey[:], []byte{12, 0, 0, 0})
+	return guessedKey[:]
+}
+
 func decryptYstb(stm []byte, key []byte, header *ystbHeader) {
 	p := uint32(binary.Size(*header))
 	decryptBlock(stm[p:p+header.CodeSize], key)
@@ -158,7 +177,7 @@ func decryptYstb(stm []byte, key []byte, header *ystbHeader) {
 }
 
 func packLineToYstbResource(arg ystbArgInfo, line string, cp int) []byte {
-	ns := codec.Encode(line, cp, codec.Replace)
+	ns := encodeText(line, cp)
 	if arg.Type == 3 {
 		var bf bytes.Buffer
 		var resInfo ystbResInfo
@@ -182,44 +201,100 @@ func isFunctionToExtract(name []byte) bool {
 	return false
 }
 
-func packTxtToYstb(script *ystbInfo, stm []byte, txt []string, ops *[256]string, codePage int, key []byte) (newStm []byte, err error) {
-	argOffStart := uint32(binary.Size(script.Header)) + script.Header.CodeSize
-	argStm := memio.NewWithBytes(stm[argOffStart : argOffStart+script.Header.ArgSize])
-
-	var resTail bytes.Buffer
+type ystbTextRef struct {
+	Inst int
+	Arg  int
+}
 
-	resNewOffset := script.Header.ResourceSize
-	argIdx := 0
-	txtIdx := 0
-	for _, inst := range script.Insts {
+// ystbTextRefs lists the arguments holding translatable text, in the order
+// they appear in txt files. Extraction and packing both walk this list so the
+// line numbers always stay in sync.
+func ystbTextRefs(script *ystbInfo, ops *[256]string, codePage int) (refs []ystbTextRef, err error) {
+	refs = make([]ystbTextRef, 0, len(script.Insts)/3)
+	for i, inst := range script.Insts {
 		if ops[inst.Op] == "msg" {
-			ns := packLineToYstbResource(inst.Args[0], txt[txtIdx], codePage)
-			txtIdx++
-			resTail.Write(ns)
-			argStm.Seek(int64(argIdx*12)+4, 0)
-			binary.Write(argStm, binary.LittleEndian, uint32(len(ns)))
-			binary.Write(argStm, binary.LittleEndian, resNewOffset)
-			resNewOffset += uint32(len(ns))
+			if len(inst.Args) != 1 {
+				err = fmt.Errorf("the message op:0x%X has not only 1 argument", inst.Op)
+				return
+			}
+			refs = append(refs, ystbTextRef{i, 0})
 		} else if ops[inst.Op] == "call" {
-			if isFunctionToExtract(inst.Args[0].Res.Res) {
-				for i, arg := range inst.Args[1:] {
-					if arg.Type == 3 &&
-						bytes.Compare(arg.Res.Res, []byte(`""`)) != 0 &&
-						bytes.Compare(arg.Res.Res, []byte(`''`)) != 0 {
-						ns := packLineToYstbResource(arg, txt[txtIdx], codePage)
-						txtIdx++
-						resTail.Write(ns)
-						argStm.Seek(int64((argIdx+1+i)*12)+4, 0)
-						binary.Write(argStm, binary.LittleEndian, uint32(len(ns)))
-						binary.Write(argStm, binary.LittleEndian, resNewOffset)
-						resNewOffset += uint32(len(ns))
-					}
+			if len(inst.Args) < 1 {
+				err = fmt.Errorf("call op:0x%X argument less than 1", inst.Op)
+				return
+			}
+			extract := isFunctionToExtract(inst.Args[0].Res.Res)
+			if !extract && !gProfile.AllStrings {
+				continue
+			}
+			function := strings.ToLower(strings.Trim(string(inst.Args[0].Res.Res), `"`))
+			for j, arg := range inst.Args[1:] {
+				if arg.Type == 3 &&
+					bytes.Compare(arg.Res.Res, []byte(`""`)) != 0 &&
+					bytes.Compare(arg.Res.Res, []byte(`''`)) != 0 &&
+					isTranslatableLiteral(function, decodeText(arg.Res.Res, codePage), extract) {
+					refs = append(refs, ystbTextRef{i, j + 1})
 				}
 			}
 		}
+	}
+	return
+}
+
+// ystbRefId returns the stable id of a referenced argument, e.g. yst00012:145:0.
+func ystbRefId(name string, ref ystbTextRef) string {
+	return fmt.Sprintf("%s:%d:%d", name, ref.Inst, ref.Arg)
+}
+
+// ystbRefBytes returns the encoded text of a referenced argument.
+func ystbRefBytes(script *ystbInfo, ref ystbTextRef) []byte {
+	arg := &script.Insts[ref.Inst].Args[ref.Arg]
+	if arg.Type == 3 {
+		// for English games, it seems the msg op uses type-3 resource
+		return arg.Res.Res
+	}
+	// and for Japanese games, it usually uses raw resource
+	return arg.Res.ResRaw
+}
+
+func packTxtToYstb(script *ystbInfo, name string, stm []byte, txt []string, ops *[256]string, codePage int, key []byte) (newStm []byte, err error) {
+	argOffStart := uint32(binary.Size(script.Header)) + script.Header.CodeSize
+	argStm := memio.NewWithBytes(stm[argOffStart : argOffStart+script.Header.ArgSize])
+
+	var resTail bytes.Buffer
+
+	refs, err := ystbTextRefs(script, ops, codePage)
+	if err != nil {
+		return
+	}
+	if len(txt) < len(refs) {
+		err = fmt.Errorf("text has %d lines, script needs %d", len(txt), len(refs))
+		return
+	}
+	argStarts := make([]int, len(script.Insts))
+	argIdx := 0
+	for i, inst := range script.Insts {
+		argStarts[i] = argIdx
 		argIdx += len(inst.Args)
 	}
 
+	resNewOffset := script.Header.ResourceSize
+	for txtIdx, ref := range refs {
+		line := txt[txtIdx]
+		original := decodeText(ystbRefBytes(script, ref), codePage)
+		id := fmt.Sprintf("%s (line %d)", ystbRefId(name, ref), txtIdx+1)
+		reportMarkup(id, original, line)
+		if ops[script.Insts[ref.Inst].Op] == "msg" {
+			line = wrapPackedMessage(line, original, id, codePage)
+		}
+		ns := packLineToYstbResource(script.Insts[ref.Inst].Args[ref.Arg], line, codePage)
+		resTail.Write(ns)
+		argStm.Seek(int64((argStarts[ref.Inst]+ref.Arg)*12)+4, 0)
+		binary.Write(argStm, binary.LittleEndian, uint32(len(ns)))
+		binary.Write(argStm, binary.LittleEndian, resNewOffset)
+		resNewOffset += uint32(len(ns))
+	}
+
 	var newYbn bytes.Buffer
 	newHdr := script.Header
 	newHdr.ResourceSize += uint32(resTail.Len())
@@ -241,7 +316,7 @@ func packTxtToYstb(script *ystbInfo, stm []byte, txt []string, ops *[256]string,
 	return outputStm, nil
 }
 
-func packYstbFile(oriStm []byte, txtName, outYbnName string, key []byte, ops *[256]string, codePage int) bool {
+func packYstbFile(oriStm []byte, name, txtName, outYbnName string, key []byte, ops *[256]string, codePage int) bool {
 	logln("parsing ybn...")
 	script, err := parseYstb(oriStm, key, "")
 	if err != nil {
@@ -261,7 +336,7 @@ func packYstbFile(oriStm []byte, txtName, outYbnName string, key []byte, ops *[2
 	}
 	logf("reading text finished, %d lines\n", len(ls))
 	logln("packing text to ybn...")
-	newStm, err := packTxtToYstb(&script, oriStm, ls, ops, codePage, key)
+	newStm, err := packTxtToYstb(&script, name, oriStm, ls, ops, codePage, key)
 	if err != nil {
 		fmt.Println(err)
 		return false
@@ -278,46 +353,22 @@ func decodeScriptString(script *ystbInfo, ops *[256]string, codePage int) {
 		for j := range inst.Args {
 			res := &inst.Args[j].Res
 			if len(res.Res) != 0 && res.Type == 77 {
-				res.ResStr = codec.Decode(res.Res, codePage)
+				res.ResStr = decodeText(res.Res, codePage)
 			} else if ops[inst.Op] == "msg" {
-				res.ResStr = codec.Decode(res.ResRaw, codePage)
+				res.ResStr = decodeText(res.ResRaw, codePage)
 			}
 		}
 	}
 }
 
 func extTxtFromYbn(script *ystbInfo, ops *[256]string, codePage int) (txt []string, err error) {
-	txt = make([]string, 0, len(script.Insts)/3)
-	for _, inst := range script.Insts {
-		if ops[inst.Op] == "msg" {
-			if len(inst.Args) != 1 {
-				err = fmt.Errorf("the message op:0x%X has not only 1 argument", inst.Op)
-				return
-			}
-			var rawStr []byte
-			if inst.Args[0].Type == 3 {
-				// for English games, it seems the msg op uses type-3 resource
-				rawStr = inst.Args[0].Res.Res
-			} else {
-				// and for Japanese games, it usually uses raw resource
-				rawStr = inst.Args[0].Res.ResRaw
-			}
-			txt = append(txt, codec.Decode(rawStr, codePage))
-		} else if ops[inst.Op] == "call" {
-			if len(inst.Args) < 1 {
-				err = fmt.Errorf("call op:0x%X argument less than 1", inst.Op)
-				return
-			}
-			if isFunctionToExtract(inst.Args[0].Res.Res) {
-				for _, arg := range inst.Args[1:] {
-					if arg.Type == 3 &&
-						bytes.Compare(arg.Res.Res, []byte(`""`)) != 0 &&
-						bytes.Compare(arg.Res.Res, []byte(`''`)) != 0 {
-						txt = append(txt, codec.Decode(arg.Res.Res, codePage))
-					}
-				}
-			}
-		}
+	refs, err := ystbTextRefs(script, ops, codePage)
+	if err != nil {
+		return
+	}
+	txt = make([]string, len(refs))
+	for i, ref := range refs {
+		txt[i] = decodeText(ystbRefBytes(script, ref), codePage)
 	}
 	return
 }
@@ -326,13 +377,75 @@ func resStr(res ystbResourceEntry, codePage int) string {
 	if len(res.ResStr) != 0 {
 		return res.ResStr
 	} else if len(res.Res) != 0 {
-		return codec.Decode(res.Res, codePage)
+		return decodeText(res.Res, codePage)
 	} else if len(res.ResRaw) != 0 {
-		return codec.Decode(res.ResRaw, codePage)
+		return decodeText(res.ResRaw, codePage)
 	}
 	return ""
 }
 
+var ystbResTypes = map[uint8]string{
+	77: "str",
+}
+
+// ystbArgInstruct renders an argument like 0: 3 ->"text" for instruct files.
+func ystbArgInstruct(arg *ystbArgInfo, codePage int) string {
+	out := strconv.Itoa(int(arg.Value)) + ": " + strconv.Itoa(int(arg.Type)) + " ->"
+	resType, ok := ystbResTypes[arg.Res.Type]
+	if !ok {
+		resType = strconv.Itoa(int(arg.Res.Type))
+	}
+	if resType == "str" {
+		resS := resStr(arg.Res, codePage)
+		if resS != "''" {
+			return out + resS
+		}
+		return out + "null"
+	}
+	if len(arg.Res.ResRaw) != 0 {
+		out += base64.StdEncoding.EncodeToString(arg.Res.ResRaw)
+	} else if len(arg.Res.Res) != 0 {
+		out += base64.StdEncoding.EncodeToString(arg.Res.Res)
+	} else if arg.ResOffset != 0 && arg.ResInfo != 0 {
+		out += fmt.Sprintf("res::(%v--%v)", arg.ResInfo, arg.ResOffset)
+	} else {
+		out += "~"
+	}
+	return out + ":" + resType
+}
+
+// ystbInstructLine renders an instruction as a line of an instruct file.
+func ystbInstructLine(inst *ystbInstInfo, ops *[256]string, codePage int) string {
+	op := ops[int(inst.Op)]
+	if op == "" { //!op
+		op = strconv.Itoa(int(inst.Op))
+	}
+	switch op {
+	case "msg":
+		return strings.ReplaceAll(resStr(inst.Args[0].Res, codePage), "\"", "")
+	case "msg-meta":
+		out := "msg-data(" + strconv.Itoa(int(inst.Args[0].Value))
+		if len(inst.Args[0].Res.ResRaw) != 0 {
+			out += ", " + base64.StdEncoding.EncodeToString(inst.Args[0].Res.ResRaw)
+		}
+		return out + ")"
+	}
+	first := 0
+	out := "\\" + op
+	if op == "call" {
+		out = "\\" + strings.ReplaceAll(resStr(inst.Args[0].Res, codePage), "\"", "")
+		first = 1
+	}
+	out += "("
+	for i := first; i < len(inst.Args); i++ {
+		out += ystbArgInstruct(&inst.Args[i], codePage)
+		if i+1 < len(inst.Args) {
+			out += ", "
+		}
+	}
+	return out + ")"
+}
+
 func parseYstbFile(oriStm []byte, outJsonName, outTxtName, outDecryptName, outInstructName string, key []byte, ops *[256]string, codePage int) bool {
 	logln("parsing ybn...")
 	script, err := parseYstb(oriStm, key, outDecryptName)
@@ -358,106 +471,10 @@ func parseYstbFile(oriStm []byte, outJsonName, outTxtName, outDecryptName, outIn
 		os.WriteFile(outJsonName, out, os.ModePerm)
 	}
 	if outInstructName != "" {
-		resTypes := map[uint8]string{
-			77: "str",
-		}
 		logln("writing instructions...")
 		out := ""
 		for i := range script.Insts {
-			inst := &script.Insts[i]
-			op := ops[int(inst.Op)]
-			if op == "" { //!op
-				op = strconv.Itoa(int(inst.Op))
-			}
-			switch op {
-			case "msg":
-				out += strings.ReplaceAll(resStr(inst.Args[0].Res, codePage), "\"", "") + "\n"
-				break
-			case "msg-meta":
-				out += "msg-data(" + strconv.Itoa(int(inst.Args[0].Value))
-				if len(inst.Args[0].Res.ResRaw) != 0 {
-					out += ", " + base64.StdEncoding.EncodeToString(inst.Args[0].Res.ResRaw)
-				}
-				out += ")\n"
-				break
-			case "call":
-				out += "\\" + strings.ReplaceAll(resStr(inst.Args[0].Res, codePage), "\"", "")
-				out += "("
-				for i := 1; i < len(inst.Args); i++ {
-					arg := &inst.Args[i]
-					out += strconv.Itoa(int(arg.Value)) + ": " + strconv.Itoa(int(arg.Type)) + " ->"
-					writeType := true
-					resType, ok := resTypes[arg.Res.Type]
-					if !ok {
-						resType = strconv.Itoa(int(arg.Res.Type))
-					}
-					if resType == "str" {
-						writeType = false
-						resS := resStr(arg.Res, codePage)
-						if resS != "''" {
-							out += resS
-						} else {
-							out += "null"
-						}
-					} else {
-						if len(arg.Res.ResRaw) != 0 {
-							out += base64.StdEncoding.EncodeToString(arg.Res.ResRaw)
-						} else if len(arg.Res.Res) != 0 {
-							out += base64.StdEncoding.EncodeToString(arg.Res.Res)
-						} else if arg.ResOffset != 0 && arg.ResInfo != 0 {
-							out += fmt.Sprintf("res::(%v--%v)", arg.ResInfo, arg.ResOffset)
-						} else {
-							out += "~"
-						}
-					}
-					if writeType {
-						out += ":" + resType
-					}
-					if i+1 < len(inst.Args) {
-						out += ", "
-					}
-				}
-				out += ")\n"
-				break
-			default:
-				out += "\\" + op
-				out += "("
-				for i := 0; i < len(inst.Args); i++ {
-					arg := &inst.Args[i]
-					out += strconv.Itoa(int(arg.Value)) + ": " + strconv.Itoa(int(arg.Type)) + " ->"
-					writeType := true
-					resType, ok := resTypes[arg.Res.Type]
-					if !ok {
-						resType = strconv.Itoa(int(arg.Res.Type))
-					}
-					if resType == "str" {
-						writeType = false
-						resS := resStr(arg.Res, codePage)
-						if resS != "''" {
-							out += resS
-						} else {
-							out += "null"
-						}
-					} else {
-						if len(arg.Res.ResRaw) != 0 {
-							out += base64.StdEncoding.EncodeToString(arg.Res.ResRaw)
-						} else if len(arg.Res.Res) != 0 {
-							out += base64.StdEncoding.EncodeToString(arg.Res.Res)
-						} else if arg.ResOffset != 0 && arg.ResInfo != 0 {
-							out += fmt.Sprintf("res::(%v--%v)", arg.ResInfo, arg.ResOffset)
-						} else {
-							out += "~"
-						}
-					}
-					if writeType {
-						out += ":" + resType
-					}
-					if i+1 < len(inst.Args) {
-						out += ", "
-					}
-				}
-				out += ")\n"
-			}
+			out += ystbInstructLine(&script.Insts[i], ops, codePage) + "\n"
 		}
 		os.WriteFile(outInstructName, []byte(out), os.ModePerm)
 	}
@@ -5,9 +5,13 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"github.com/regomne/eutil/codec"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type ystlHeader struct {
@@ -24,12 +28,66 @@ type ystlScriptInfo struct {
 	Id               uint32
 	SourceLength     uint32
 	Source           string
-	ModificationTime uint64
+	ModificationTime fileTime
 	VarCount         uint32
 	LblCount         uint32
 	TxtCount         uint32
 }
 
+// fileTime is a Windows FILETIME, the number of 100 nanosecond intervals
+// since 1601-01-01 UTC. It is shown as ISO-8601.
+type fileTime uint64
+
+// fileTimeEpoch is the Unix time of 1601-01-01 UTC in seconds.
+const fileTimeEpoch = -11644473600
+
+const fileTimeLayout = "2006-01-02T15:04:05.9999999Z07:00"
+
+func fileTimeOf(t time.Time) fileTime {
+	return fileTime(uint64(t.Unix()-fileTimeEpoch)*10000000 + uint64(t.Nanosecond()/100))
+}
+
+func (t fileTime) Time() time.Time {
+	return time.Unix(int64(t/10000000)+fileTimeEpoch, int64(t%10000000)*100).UTC()
+}
+
+// String formats the time as ISO-8601, or as the raw number if the year
+// can't be written with four digits.
+func (t fileTime) String() string {
+	if tm := t.Time(); tm.Year() <= 9999 {
+		return tm.Format(fileTimeLayout)
+	}
+	return strconv.FormatUint(uint64(t), 10)
+}
+
+// parseFileTime reads an ISO-8601 time or a raw FILETIME number.
+func parseFileTime(s string) (fileTime, error) {
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return fileTime(n), nil
+	}
+	tm, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, fmt.Errorf("bad time: %s", s)
+	}
+	if tm.Unix() < fileTimeEpoch {
+		return 0, fmt.Errorf("time before 1601: %s", s)
+	}
+	return fileTimeOf(tm), nil
+}
+
+func (t fileTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *fileTime) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	if json.Unmarshal(b, &s) != nil {
+		s = string(b)
+	}
+	*t, err = parseFileTime(s)
+	return
+}
+
 func parseYstlFile(oriStm []byte, outJsonName, outInstructName string, codePage int) bool {
 	logln("parsing ybn...")
 	script, err := parseYstl(oriStm, codePage)
@@ -60,6 +118,10 @@ func parseYstlFile(oriStm []byte, outJsonName, outInstructName string, codePage
 	return true
 }
 
+// ystlScriptMinSize is the size of a script with an empty source, to reject
+// counts larger than the file before allocating them.
+const ystlScriptMinSize = 4 + 4 + 8 + 4 + 4 + 4
+
 func parseYstl(oriStm []byte, codePage int) (script ystlInfo, err error) {
 	stm := bytes.NewReader(oriStm)
 	binary.Read(stm, binary.LittleEndian, &script.Header)
@@ -69,15 +131,23 @@ func parseYstl(oriStm []byte, codePage int) (script ystlInfo, err error) {
 		err = fmt.Errorf("not a ybn file")
 		return
 	}
+	if int64(script.Header.Count) > int64(stm.Len()/ystlScriptMinSize) {
+		err = fmt.Errorf("%d scripts exceed the file", script.Header.Count)
+		return
+	}
 	script.Scripts = make([]ystlScriptInfo, script.Header.Count)
 	for i := 0; i < int(script.Header.Count); i++ {
 		scr := &script.Scripts[i]
 		binary.Read(stm, binary.LittleEndian, &scr.Id)
 		var sourceLength uint32
 		binary.Read(stm, binary.LittleEndian, &sourceLength)
+		if int64(sourceLength) > int64(stm.Len()) {
+			err = fmt.Errorf("script %d: source of %d bytes exceeds the file", i, sourceLength)
+			return
+		}
 		encodedName := make([]byte, sourceLength)
 		stm.Read(encodedName)
-		scr.Source = codec.Decode(encodedName, codePage)
+		scr.Source = decodeText(encodedName, codePage)
 		binary.Read(stm, binary.LittleEndian, &scr.ModificationTime)
 		binary.Read(stm, binary.LittleEndian, &scr.VarCount)
 		binary.Read(stm, binary.LittleEndian, &scr.LblCount)
@@ -85,3 +155,190 @@ func parseYstl(oriStm []byte, codePage int) (script ystlInfo, err error) {
 	}
 	return
 }
+
+var ystlInstructRegex = regexp.MustCompile(`^yst(\d+)\.ybn => (.*?)(?:  \(([^,]*),(\d+),(\d+),(\d+)\))?$`)
+
+// readYstlInstruct reads the scripts of an instruct file. Lines of new
+// scripts may leave out the time and counts, they are filled in when packing.
+func readYstlInstruct(instructName string) (scripts []ystlScriptInfo, err error) {
+	stm, err := os.ReadFile(instructName)
+	if err != nil {
+		return
+	}
+	for n, line := range strings.Split(string(bytes.TrimPrefix(stm, []byte("\ufeff"))), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		m := ystlInstructRegex.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: not a script: %s", n+1, line)
+		}
+		id, e := strconv.ParseUint(m[1], 10, 32)
+		if e != nil {
+			return nil, fmt.Errorf("line %d: bad script id: %s", n+1, line)
+		}
+		scr := ystlScriptInfo{Id: uint32(id), Source: m[2]}
+		if m[3] != "" {
+			if scr.ModificationTime, e = parseFileTime(m[3]); e != nil {
+				return nil, fmt.Errorf("line %d: %v", n+1, e)
+			}
+			counts := []*uint32{&scr.VarCount, &scr.LblCount, &scr.TxtCount}
+			for i, c := range counts {
+				v, e := strconv.ParseUint(m[4+i], 10, 32)
+				if e != nil {
+					return nil, fmt.Errorf("line %d: bad count: %s", n+1, line)
+				}
+				*c = uint32(v)
+			}
+		}
+		scripts = append(scripts, scr)
+	}
+	return
+}
+
+// packYstl sorts the scripts by id and encodes their sources.
+func packYstl(script *ystlInfo, codePage int) ([]byte, error) {
+	scripts := script.Scripts
+	sort.SliceStable(scripts, func(i, j int) bool {
+		return scripts[i].Id < scripts[j].Id
+	})
+	header := script.Header
+	copy(header.Meta.Magic[:], "YSTL")
+	header.Count = uint32(len(scripts))
+	var bf bytes.Buffer
+	binary.Write(&bf, binary.LittleEndian, &header)
+	for i := range scripts {
+		scr := &scripts[i]
+		if i > 0 && scr.Id == scripts[i-1].Id {
+			return nil, fmt.Errorf("yst%05d is listed twice", scr.Id)
+		}
+		encodedName := encodeText(scr.Source, codePage)
+		scr.SourceLength = uint32(len(encodedName))
+		binary.Write(&bf, binary.LittleEndian, scr.Id)
+		binary.Write(&bf, binary.LittleEndian, scr.SourceLength)
+		bf.Write(encodedName)
+		binary.Write(&bf, binary.LittleEndian, scr.ModificationTime)
+		binary.Write(&bf, binary.LittleEndian, scr.VarCount)
+		binary.Write(&bf, binary.LittleEndian, scr.LblCount)
+		binary.Write(&bf, binary.LittleEndian, scr.TxtCount)
+	}
+	return bf.Bytes(), nil
+}
+
+// updateYstlCounts sets the counts of the listed scripts from the game in
+// inDir, with the scripts, ysl.ybn and ysv.ybn already written to outDir
+// taking the place of the original ones. Scripts that were rebuilt, whose
+// counts changed or that are new get the current time. Files that fail to
+// load or whose opcodes can't be guessed are an error, as their counts would
+// be wrong.
+func updateYstlCounts(script *ystlInfo, inDir, outDir string, key []byte, guessKey bool, ops *[256]string, codePage int) error {
+	game, problems, err := loadGameFiles(inDir, key, guessKey, ops, codePage)
+	if err != nil {
+		return err
+	}
+	rebuilt := map[uint32]bool{}
+	if outDir != inDir && isDir(outDir) {
+		out, outProblems, err := loadGameFiles(outDir, key, guessKey, ops, codePage)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, outProblems...)
+		for id, scr := range out.Scripts {
+			name := fmt.Sprintf("yst%05d.ybn", id)
+			oldStm, _ := os.ReadFile(filepath.Join(inDir, name))
+			newStm, _ := os.ReadFile(filepath.Join(outDir, name))
+			rebuilt[id] = !bytes.Equal(oldStm, newStm)
+			game.Scripts[id] = scr
+		}
+		if out.Labels != nil {
+			game.Labels = out.Labels
+		}
+		if out.Variables != nil {
+			game.Variables = out.Variables
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("can't recount the scripts:\n%s", strings.Join(problems, "\n"))
+	}
+	labels, texts, vars := game.counts(ops)
+	listed := map[uint32]bool{}
+	now := fileTimeOf(time.Now())
+	for i := range script.Scripts {
+		scr := &script.Scripts[i]
+		listed[scr.Id] = true
+		if _, ok := game.Scripts[scr.Id]; !ok {
+			fmt.Printf("yst%05d.ybn not found, the counts of %s are kept\n", scr.Id, scr.Source)
+			continue
+		}
+		counts := [3]uint32{uint32(vars[scr.Id]), uint32(labels[scr.Id]), uint32(texts[scr.Id])}
+		if game.Variables == nil {
+			counts[0] = scr.VarCount
+		}
+		if game.Labels == nil {
+			counts[1] = scr.LblCount
+		}
+		changed := counts != [3]uint32{scr.VarCount, scr.LblCount, scr.TxtCount}
+		if changed || rebuilt[scr.Id] || scr.ModificationTime == 0 {
+			logf("yst%05d: counts %d,%d,%d -> %d,%d,%d\n", scr.Id, scr.VarCount, scr.LblCount, scr.TxtCount, counts[0], counts[1], counts[2])
+			scr.VarCount, scr.LblCount, scr.TxtCount = counts[0], counts[1], counts[2]
+			scr.ModificationTime = now
+		}
+	}
+	var ids []int
+	for id := range game.Scripts {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if !listed[uint32(id)] {
+			fmt.Printf("yst%05d.ybn is not listed, add it with its source\n", id)
+		}
+	}
+	return nil
+}
+
+// packYstlFile packs yst_list.ybn from json or instruct and updates the
+// counts and times from the scripts of the game.
+func packYstlFile(oriStm []byte, inDir, inJsonName, inInstructName, outYbnName string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
+	logln("parsing ybn...")
+	script, err := parseYstl(oriStm, codePage)
+	if err != nil {
+		fmt.Println("parse error:", err)
+		return false
+	}
+	if inJsonName != "" {
+		logln("reading json:", inJsonName)
+		stm, err := os.ReadFile(inJsonName)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		var list ystlInfo
+		if err := json.Unmarshal(stm, &list); err != nil {
+			fmt.Println("error when parsing json:", err)
+			return false
+		}
+		script.Scripts = list.Scripts
+	} else {
+		logln("reading instruct:", inInstructName)
+		script.Scripts, err = readYstlInstruct(inInstructName)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+	}
+	if err := updateYstlCounts(&script, inDir, filepath.Dir(outYbnName), key, guessKey, ops, codePage); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	newStm, err := packYstl(&script, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logln("writing ybn:", outYbnName)
+	os.WriteFile(outYbnName, newStm, os.ModePerm)
+	logln("complete.")
+	return true
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/regomne/eutil/codec"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileTime(t *testing.T) {
+	tests := []struct {
+		t fileTime
+		s string
+	}{
+		{0, "1601-01-01T00:00:00Z"},
+		{133000000000000000, "2022-06-18T04:26:40Z"},
+		{133000000000000001, "2022-06-18T04:26:40.0000001Z"},
+		{116444736000000000, "1970-01-01T00:00:00Z"},
+		{0xFFFFFFFFFFFFFFFF, "18446744073709551615"},
+	}
+	for _, tt := range tests {
+		if s := tt.t.String(); s != tt.s {
+			t.Errorf("fileTime(%d) = %s, want %s", uint64(tt.t), s, tt.s)
+		}
+		if got, err := parseFileTime(tt.s); err != nil || got != tt.t {
+			t.Errorf("parseFileTime(%s) = %d, %v, want %d", tt.s, uint64(got), err, uint64(tt.t))
+		}
+		out, err := json.Marshal(tt.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got fileTime
+		if err := json.Unmarshal(out, &got); err != nil || got != tt.t {
+			t.Errorf("json %s = %d, %v, want %d", out, uint64(got), err, uint64(tt.t))
+		}
+	}
+}
+
+func TestParseFileTime(t *testing.T) {
+	tests := []struct {
+		s    string
+		want fileTime
+		ok   bool
+	}{
+		{"2022-06-18T13:26:40+09:00", 133000000000000000, true},
+		{"133000000000000000", 133000000000000000, true},
+		{"1600-12-31T23:59:59Z", 0, false},
+		{"2022-06-18 04:26:40", 0, false},
+		{"-1", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseFileTime(tt.s)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseFileTime(%q) = %d, %v", tt.s, uint64(got), err)
+		}
+	}
+	var raw fileTime
+	if err := json.Unmarshal([]byte("133000000000000000"), &raw); err != nil || raw != 133000000000000000 {
+		t.Errorf("json number = %d, %v", uint64(raw), err)
+	}
+}
+
+// ystlBytes encodes a YSTL file with scripts sorted by id.
+func ystlBytes(scripts ...ystlScriptInfo) []byte {
+	fields := []any{uint32(len(scripts))}
+	for _, scr := range scripts {
+		source := encodeText(scr.Source, codec.C932)
+		fields = append(fields, scr.Id, uint32(len(source)), source, uint64(scr.ModificationTime), scr.VarCount, scr.LblCount, scr.TxtCount)
+	}
+	return ybnBytes("YSTL", fields...)
+}
+
+var testYstlScripts = []ystlScriptInfo{
+	{Id: 0, Source: `data\script\es\init.yst`, ModificationTime: 133000000000000000, VarCount: 3, LblCount: 1},
+	{Id: 1, Source: `data\script\第一章.yst`, ModificationTime: 133000000000000123, LblCount: 4, TxtCount: 210},
+	{Id: 5, Source: `data\script\end.yst`, ModificationTime: 0xFFFFFFFFFFFFFFFF},
+}
+
+func TestPackYstlFromJson(t *testing.T) {
+	stm := ystlBytes(testYstlScripts...)
+	script, err := parseYstl(stm, codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list ystlInfo
+	if err := json.Unmarshal(out, &list); err != nil {
+		t.Fatal(err)
+	}
+	script.Scripts = append(list.Scripts[1:], list.Scripts[0])
+	newStm, err := packYstl(&script, codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(newStm, stm) {
+		t.Errorf("packed\n% x\nwant\n% x", newStm, stm)
+	}
+}
+
+func TestPackYstlFromInstruct(t *testing.T) {
+	stm := ystlBytes(testYstlScripts...)
+	instructName := filepath.Join(t.TempDir(), "yst_list.ybn.instruct")
+	if !parseYstlFile(stm, "", instructName, codec.C932) {
+		t.Fatal("parseYstlFile failed")
+	}
+	script, err := parseYstl(stm, codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if script.Scripts, err = readYstlInstruct(instructName); err != nil {
+		t.Fatal(err)
+	}
+	newStm, err := packYstl(&script, codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(newStm, stm) {
+		t.Errorf("packed\n% x\nwant\n% x", newStm, stm)
+	}
+}
+
+func TestReadYstlInstruct(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		text string
+		want []ystlScriptInfo
+		err  string
+	}{
+		{
+			"\ufeffyst00000.ybn => data\\script\\a.yst  (2022-06-18T04:26:40Z,1,2,3)\r\n\r\nyst00012.ybn => data\\script\\new.yst\r\n",
+			[]ystlScriptInfo{
+				{Id: 0, Source: `data\script\a.yst`, ModificationTime: 133000000000000000, VarCount: 1, LblCount: 2, TxtCount: 3},
+				{Id: 12, Source: `data\script\new.yst`},
+			},
+			"",
+		},
+		{"yst00000.ybn => a.yst  (yesterday,1,2,3)\n", nil, "line 1: bad time"},
+		{"yst00000.ybn => a.yst\nscript.ybn => b.yst\n", nil, "line 2: not a script"},
+		{"yst99999999999.ybn => a.yst\n", nil, "line 1: bad script id"},
+		{"yst00000.ybn => a.yst  (0,1,2,99999999999)\n", nil, "line 1: bad count"},
+	}
+	for i, tt := range tests {
+		name := filepath.Join(dir, "test.instruct")
+		if err := os.WriteFile(name, []byte(tt.text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readYstlInstruct(name)
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%d: readYstlInstruct = %v, want an error %q", i, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d: readYstlInstruct = %+v, %v, want %+v", i, got, err, tt.want)
+		}
+	}
+}
+
+// TestUpdateYstlCountsFailsOnBrokenFiles checks that counts aren't taken
+// from a game whose files don't load.
+func TestUpdateYstlCountsFailsOnBrokenFiles(t *testing.T) {
+	dir := t.TempDir()
+	broken := ysvrBytes(ysvrTestVariable{ysvrVariableHeader{1, 0, 1, 1, 0}, nil, nil})
+	if err := os.WriteFile(filepath.Join(dir, "ysv.ybn"), broken, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var ops [256]string
+	script := ystlInfo{Scripts: append([]ystlScriptInfo(nil), testYstlScripts...)}
+	err := updateYstlCounts(&script, dir, dir, nil, false, &ops, codec.C932)
+	if err == nil || !strings.Contains(err.Error(), "ysv.ybn") {
+		t.Errorf("updateYstlCounts = %v, want an error for ysv.ybn", err)
+	}
+	if !reflect.DeepEqual(script.Scripts, testYstlScripts) {
+		t.Errorf("the counts were changed: %+v", script.Scripts)
+	}
+}
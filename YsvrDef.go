@@ -5,7 +5,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"github.com/regomne/eutil/codec"
+	"io"
 	"os"
 )
 
@@ -30,7 +30,7 @@ type ysvrVariableHeader struct {
 type ysvrVariable struct {
 	Header  ysvrVariableHeader
 	DimSize []uint32
-	Data    any
+	Data    any // a value, or nested slices of values for arrays
 }
 
 func parseYsvrFile(oriStm []byte, outJsonName string, codePage int) bool {
@@ -55,7 +55,10 @@ func parseYsvrFile(oriStm []byte, outJsonName string, codePage int) bool {
 
 func parseYsvr(oriStm []byte, codePage int) (script ysvrInfo, err error) {
 	stm := bytes.NewReader(oriStm)
-	binary.Read(stm, binary.LittleEndian, &script.Header)
+	if err = binary.Read(stm, binary.LittleEndian, &script.Header); err != nil {
+		err = fmt.Errorf("not a ybn file")
+		return
+	}
 	logln("header:", script.Header)
 	header := &script.Header
 	if bytes.Compare(header.Meta.Magic[:], []byte("YSVR")) != 0 {
@@ -64,31 +67,204 @@ func parseYsvr(oriStm []byte, codePage int) (script ysvrInfo, err error) {
 	}
 	script.Data = make([]ysvrVariable, script.Header.Count)
 	for i := 0; i < int(script.Header.Count); i++ {
-		datatype := &script.Data[i]
-		binary.Read(stm, binary.LittleEndian, &datatype.Header)
-		datatype.DimSize = make([]uint32, datatype.Header.DimCount)
-		binary.Read(stm, binary.LittleEndian, &datatype.DimSize)
-		switch datatype.Header.Type {
-		case 0:
-			break
-		case 1:
-			var i int64
-			binary.Read(stm, binary.LittleEndian, &i)
-			datatype.Data = i
-			break
-		case 2:
-			var i float64
-			binary.Read(stm, binary.LittleEndian, &i)
-			datatype.Data = i
-			break
-		case 3:
-			var i uint16
-			binary.Read(stm, binary.LittleEndian, &i)
-			b := make([]byte, i)
-			stm.Read(b)
-			datatype.Data = codec.Decode(b[:], codePage)
+		variable := &script.Data[i]
+		if err = binary.Read(stm, binary.LittleEndian, &variable.Header); err != nil {
+			err = fmt.Errorf("variable %d: header truncated", i)
+			return
+		}
+		variable.DimSize = make([]uint32, variable.Header.DimCount)
+		if err = binary.Read(stm, binary.LittleEndian, &variable.DimSize); err != nil {
+			err = fmt.Errorf("variable %d: dimensions truncated", i)
+			return
+		}
+		if variable.Data, err = readYsvrArray(stm, variable.Header.Type, variable.DimSize, codePage); err != nil {
+			err = fmt.Errorf("variable %d (index %d): %v", i, variable.Header.VarIndex, err)
+			return
+		}
+	}
+	if stm.Len() != 0 {
+		err = fmt.Errorf("%d bytes left after %d variables", stm.Len(), script.Header.Count)
+	}
+	return
+}
+
+// ysvrValueSize is the smallest size of a value of each type, to reject
+// dimensions larger than the file before allocating them.
+var ysvrValueSize = map[uint8]int{0: 0, 1: 8, 2: 8, 3: 2}
+
+// readYsvrArray reads the values of a variable, nested by its dimensions
+// with the first one outermost. Scalars have no dimensions. Type 0 has no
+// values, so it can't have dimensions either.
+func readYsvrArray(stm *bytes.Reader, typ uint8, dims []uint32, codePage int) (any, error) {
+	size, ok := ysvrValueSize[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %d", typ)
+	}
+	if len(dims) == 0 {
+		return readYsvrValue(stm, typ, codePage)
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("type %d can't have dimensions %v", typ, dims)
+	}
+	count := 1
+	for _, d := range dims {
+		if d != 0 && count > stm.Len()/size/int(d) {
+			return nil, fmt.Errorf("dimensions %v exceed the file", dims)
+		}
+		count *= int(d)
+	}
+	values := make([]any, dims[0])
+	for i := range values {
+		v, err := readYsvrArray(stm, typ, dims[1:], codePage)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func readYsvrValue(stm *bytes.Reader, typ uint8, codePage int) (value any, err error) {
+	switch typ {
+	case 1:
+		var v int64
+		err = binary.Read(stm, binary.LittleEndian, &v)
+		value = v
+	case 2:
+		var v float64
+		err = binary.Read(stm, binary.LittleEndian, &v)
+		value = v
+	case 3:
+		var n uint16
+		if err = binary.Read(stm, binary.LittleEndian, &n); err != nil {
 			break
 		}
+		b := make([]byte, n)
+		if _, err = io.ReadFull(stm, b); err == nil {
+			value = decodeText(b, codePage)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("value truncated")
 	}
 	return
 }
+
+// writeYsvrArray writes the values of a variable, checking that they are
+// nested like its dimensions and of its type.
+func writeYsvrArray(bf *bytes.Buffer, typ uint8, dims []uint32, value any, codePage int) error {
+	if len(dims) == 0 {
+		return writeYsvrValue(bf, typ, value, codePage)
+	}
+	if ysvrValueSize[typ] == 0 {
+		return fmt.Errorf("type %d can't have dimensions %v", typ, dims)
+	}
+	values, ok := value.([]any)
+	if !ok || len(values) != int(dims[0]) {
+		return fmt.Errorf("expected an array of %d values for dimensions %v", dims[0], dims)
+	}
+	for _, v := range values {
+		if err := writeYsvrArray(bf, typ, dims[1:], v, codePage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeYsvrValue(bf *bytes.Buffer, typ uint8, value any, codePage int) error {
+	switch typ {
+	case 0:
+		if value != nil {
+			return fmt.Errorf("type 0 has no value, got %v", value)
+		}
+	case 1:
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected a long, got %v", value)
+		}
+		v, err := n.Int64()
+		if err != nil {
+			return fmt.Errorf("expected a long, got %v", value)
+		}
+		binary.Write(bf, binary.LittleEndian, v)
+	case 2:
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected a double, got %v", value)
+		}
+		v, err := n.Float64()
+		if err != nil {
+			return fmt.Errorf("expected a double, got %v", value)
+		}
+		binary.Write(bf, binary.LittleEndian, v)
+	case 3:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %v", value)
+		}
+		b := encodeText(s, codePage)
+		if len(b) > 0xFFFF {
+			return fmt.Errorf("string of %d bytes is too long", len(b))
+		}
+		binary.Write(bf, binary.LittleEndian, uint16(len(b)))
+		bf.Write(b)
+	default:
+		return fmt.Errorf("unknown type %d", typ)
+	}
+	return nil
+}
+
+// packYsvr encodes variables as read from json, where numbers are kept as
+// json.Number so longs don't lose precision. The scope, type and dimensions
+// of every variable are checked.
+func packYsvr(script *ysvrInfo, codePage int) ([]byte, error) {
+	if len(script.Data) > 0xFFFF {
+		return nil, fmt.Errorf("too many variables: %d", len(script.Data))
+	}
+	header := script.Header
+	copy(header.Meta.Magic[:], "YSVR")
+	header.Count = uint16(len(script.Data))
+	var bf bytes.Buffer
+	binary.Write(&bf, binary.LittleEndian, &header)
+	for i := range script.Data {
+		variable := &script.Data[i]
+		h := variable.Header
+		if _, ok := ysvrScopes[h.Scope]; !ok {
+			return nil, fmt.Errorf("variable %d (index %d): unknown scope %d", i, h.VarIndex, h.Scope)
+		}
+		if int(h.DimCount) != len(variable.DimSize) {
+			return nil, fmt.Errorf("variable %d (index %d): DimCount is %d but DimSize has %d dimensions", i, h.VarIndex, h.DimCount, len(variable.DimSize))
+		}
+		binary.Write(&bf, binary.LittleEndian, &h)
+		binary.Write(&bf, binary.LittleEndian, variable.DimSize)
+		if err := writeYsvrArray(&bf, h.Type, variable.DimSize, variable.Data, codePage); err != nil {
+			return nil, fmt.Errorf("variable %d (index %d): %v", i, h.VarIndex, err)
+		}
+	}
+	return bf.Bytes(), nil
+}
+
+func packYsvrFile(inJsonName, outYbnName string, codePage int) bool {
+	logln("reading json:", inJsonName)
+	stm, err := os.ReadFile(inJsonName)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	var script ysvrInfo
+	dec := json.NewDecoder(bytes.NewReader(stm))
+	dec.UseNumber()
+	if err := dec.Decode(&script); err != nil {
+		fmt.Println("error when parsing json:", err)
+		return false
+	}
+	newStm, err := packYsvr(&script, codePage)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	logln("writing ybn:", outYbnName)
+	os.WriteFile(outYbnName, newStm, os.ModePerm)
+	logln("complete.")
+	return true
+}
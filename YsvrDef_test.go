@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/regomne/eutil/codec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type ysvrTestVariable struct {
+	Header ysvrVariableHeader
+	Dims   []uint32
+	Values []byte
+}
+
+// ysvrBytes encodes a YSVR file with the given variables, each a header,
+// its dimensions and the raw bytes of its values.
+func ysvrBytes(vars ...ysvrTestVariable) []byte {
+	fields := []any{uint16(len(vars))}
+	for _, v := range vars {
+		fields = append(fields, v.Header, v.Dims, v.Values)
+	}
+	return ybnBytes("YSVR", fields...)
+}
+
+func TestParseYsvr(t *testing.T) {
+	stm := ysvrBytes(
+		ysvrTestVariable{ysvrVariableHeader{1, 0, 1, 1, 0}, nil, le(int64(-5))},
+		ysvrTestVariable{ysvrVariableHeader{2, 3, 2, 3, 0}, nil, append(le(uint16(4)), 0x82, 0xA0, 'a', 'b')},
+		ysvrTestVariable{ysvrVariableHeader{1, 0, 3, 2, 2}, []uint32{2, 1}, le(1.5, -2.0)},
+		ysvrTestVariable{ysvrVariableHeader{1, 0, 4, 0, 0}, nil, nil},
+	)
+	script, err := parseYsvr(stm, codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{int64(-5), "あab", []any{[]any{1.5}, []any{-2.0}}, nil}
+	for i, v := range script.Data {
+		if !reflect.DeepEqual(v.Data, want[i]) {
+			t.Errorf("variable %d = %#v, want %#v", i, v.Data, want[i])
+		}
+	}
+}
+
+// TestParseYsvrMalformed checks that broken headers are rejected before
+// anything of their size is allocated.
+func TestParseYsvrMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		stm  []byte
+		err  string
+	}{
+		{"type 0 array", ysvrBytes(ysvrTestVariable{ysvrVariableHeader{1, 0, 1, 0, 1}, []uint32{0xFFFFFFFF}, nil}), "can't have dimensions"},
+		{"huge array", ysvrBytes(ysvrTestVariable{ysvrVariableHeader{1, 0, 1, 1, 1}, []uint32{0xFFFFFFFF}, le(int64(1))}), "exceed the file"},
+		{"huge nested array", ysvrBytes(ysvrTestVariable{ysvrVariableHeader{1, 0, 1, 1, 3}, []uint32{2, 0xFFFFFFFF, 0xFFFFFFFF}, le(int64(1))}), "exceed the file"},
+		{"unknown type", ysvrBytes(ysvrTestVariable{ysvrVariableHeader{1, 0, 1, 9, 0}, nil, nil}), "unknown type"},
+		{"truncated value", ysvrBytes(ysvrTestVariable{ysvrVariableHeader{1, 0, 1, 1, 0}, nil, le(int32(1))}), "truncated"},
+		{"truncated string", ysvrBytes(ysvrTestVariable{ysvrVariableHeader{1, 0, 1, 3, 0}, nil, le(uint16(5), []byte("a"))}), "truncated"},
+		{"truncated dimensions", ysvrBytes(ysvrTestVariable{ysvrVariableHeader{1, 0, 1, 1, 2}, []uint32{1}, nil}), "truncated"},
+		{"left over bytes", append(ysvrBytes(ysvrTestVariable{ysvrVariableHeader{1, 0, 1, 1, 0}, nil, le(int64(1))}), 0), "bytes left"},
+		{"not ysvr", []byte("YSTB"), "not a ybn"},
+	}
+	for _, tt := range tests {
+		_, err := parseYsvr(tt.stm, codec.C932)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: parseYsvr = %v, want an error with %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+// TestPackYsvrRoundTrip checks that packing the json of a file gives back
+// the same bytes.
+func TestPackYsvrRoundTrip(t *testing.T) {
+	stm := ysvrBytes(
+		ysvrTestVariable{ysvrVariableHeader{1, 0, 1, 0, 0}, nil, nil},
+		ysvrTestVariable{ysvrVariableHeader{1, 0, 2, 1, 0}, nil, le(int64(-1 << 62))},
+		ysvrTestVariable{ysvrVariableHeader{2, 7, 3, 2, 1}, []uint32{3}, le(0.1, -2.5, 1e300)},
+		ysvrTestVariable{ysvrVariableHeader{2, 7, 4, 3, 2}, []uint32{2, 2}, le(uint16(0), uint16(3), []byte{0x82, 0xA0, 0xFF}, uint16(1), "a", uint16(3), "bcd")},
+		ysvrTestVariable{ysvrVariableHeader{1, 0, 5, 1, 2}, []uint32{0, 4}, nil},
+	)
+	newStm, err := packYsvr(ysvrJson(t, stm), codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(newStm, stm) {
+		t.Errorf("packed\n% x\nwant\n% x", newStm, stm)
+	}
+}
+
+// ysvrJson parses a YSVR file and reads its json back as packing does.
+func ysvrJson(t *testing.T, stm []byte) *ysvrInfo {
+	script, err := parseYsvr(stm, codec.C932)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.MarshalIndent(script, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packed ysvrInfo
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.UseNumber()
+	if err := dec.Decode(&packed); err != nil {
+		t.Fatal(err)
+	}
+	return &packed
+}
+
+func TestPackYsvrRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		v    ysvrTestVariable
+		err  string
+	}{
+		{"scope 0", ysvrTestVariable{ysvrVariableHeader{0, 0, 1, 1, 0}, nil, le(int64(1))}, "unknown scope 0"},
+		{"scope 3", ysvrTestVariable{ysvrVariableHeader{3, 0, 1, 1, 0}, nil, le(int64(1))}, "unknown scope 3"},
+		{"scope 9", ysvrTestVariable{ysvrVariableHeader{9, 0, 5, 1, 2}, []uint32{0, 4}, nil}, "unknown scope 9"},
+	}
+	for _, tt := range tests {
+		_, err := packYsvr(ysvrJson(t, ysvrBytes(tt.v)), codec.C932)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: packYsvr = %v, want an error with %q", tt.name, err, tt.err)
+		}
+	}
+	script := ysvrJson(t, ysvrBytes(ysvrTestVariable{ysvrVariableHeader{1, 0, 1, 1, 1}, []uint32{2}, le(int64(1), int64(2))}))
+	script.Data[0].Data = []any{json.Number("1")}
+	if _, err := packYsvr(script, codec.C932); err == nil || !strings.Contains(err.Error(), "array of 2") {
+		t.Errorf("packYsvr of a short array = %v", err)
+	}
+	script.Data[0].Data = []any{json.Number("1"), "2"}
+	if _, err := packYsvr(script, codec.C932); err == nil || !strings.Contains(err.Error(), "expected a long") {
+		t.Errorf("packYsvr of a string in a long array = %v", err)
+	}
+}
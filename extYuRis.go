@@ -5,9 +5,8 @@ import (
 	"encoding/binary"
 	"flag"
 	"fmt"
-	"github.com/regomne/eutil/codec"
-	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -58,21 +57,36 @@ func printUsage(exeName string) {
 	fmt.Println("YBN extractor v3.0")
 	fmt.Printf("Usage: %s -e -input <ybn> [-json <json>] [-txt <txt>] [options]\n", exeName)
 	fmt.Printf("Usage: %s -p -input <ybn> -txt <txt> -new-ybn <new_ybn> [options]\n", exeName)
+	fmt.Printf("Usage: %s -e -input <ybn|dir> [-po <po>] [-pot <pot>] [-xliff <xliff>] [-csv <csv|tsv>] [options]\n", exeName)
+	fmt.Printf("Usage: %s -p -input <ybn|dir> -po <po>|-xliff <xliff>|-csv <csv|tsv> -new-ybn <new_ybn|dir> [options]\n", exeName)
+	fmt.Printf("Usage: %s -p -pseudo -input <ybn|dir> -new-ybn <new_ybn|dir> [-pseudo-expansion <ratio>] [options]\n", exeName)
+	fmt.Printf("Usage: %s -tm -input <ybn|dir> -po <po>|-xliff <xliff>|-csv <csv|tsv> -tmx <tmx> [options]\n", exeName)
+	fmt.Printf("Usage: %s -diff -input <old_ybn|dir|ypf> -new-input <new_ybn|dir|ypf> [-out <txt|json>] [options]\n", exeName)
+	fmt.Printf("Usage: %s -discover -input <ybn|dir> [-out <profile>] [options]\n", exeName)
+	fmt.Printf("Usage: %s -menus -input <ybn|dir> -out <json|po|pot|xliff|csv|tsv> [-po <po>|-xliff <xliff>|-csv <csv|tsv>] [options]\n", exeName)
+	fmt.Printf("Usage: %s -graph -input <dir> -out <dot|json> [options]\n", exeName)
+	fmt.Printf("Usage: %s -trace -input <dir> [-start <label>] [-choices <answers>] [-out <txt>] [-po <po>|-xliff <xliff>|-csv <csv|tsv>] [options]\n", exeName)
+	fmt.Printf("Usage: %s -xref -input <dir> [-out <txt|json>] [options]\n", exeName)
+	fmt.Printf("Usage: %s -check -input <dir> [options]\n", exeName)
+	fmt.Printf("Usage: %s -label-ids -input <ysl.ybn> [options]\n", exeName)
+	fmt.Printf("Usage: %s -align -input <dir> -trg-input <dir> -out <tsv|tmx> [-trg-cp <cp>] [options]\n", exeName)
+	fmt.Printf("Usage: %s -migrate -input <old_ybn|dir> -new-input <new_ybn|dir> -txt <txt>|-po <po>|-xliff <xliff>|-csv <csv|tsv> -out <file> [options]\n", exeName)
 	flag.Usage()
 
 	fmt.Printf(`
 About the extraction to different formats:
-  Repacking is only possible from a txt file generated from a ystXXXXX.ybn,
-  ysc.ybn or yse.ybn file and from an instruct file generated from yscfg.ybn.
+  Repacking is only possible from the formats marked with * below, a txt
+  file given with -txt, a translation file given with -po, -xliff or -csv
+  and a json or instruct file given with -json or -instruct.
   Some ybn variants may only support specific file formats:
-      YSCF: json,	instruct
-      YSCM:	json,	instruct,	txt
-      YSER:	json,			txt
-      YSLB:	json,	instruct,	txt
-      YSTB:	json,	instruct,	txt,	decrypt
+      YSCF: json,	instruct*
+      YSCM:	json,	instruct,	txt*,	po*,	xliff*,	csv*
+      YSER:	json,			txt*,	po*,	xliff*,	csv*
+      YSLB:	json*,	instruct*,	txt
+      YSTB:	json,	instruct,	txt*,	decrypt,	po*,	xliff*,	csv*
       YSTD:	json,	instruct
-      YSTL:	json,	instruct
-      YSVR:	json
+      YSTL:	json*,	instruct*
+      YSVR:	json*
 
   Different formats may contain different data depending on the variant.
   Which formats are supported is decided based on usefulness. In
@@ -83,6 +97,194 @@ About the extraction to different formats:
   files should be exactly only the original files without encryption.
   
 
+About packing ysv.ybn, ysl.ybn and yst_list.ybn:
+  The scope, type and dimensions of every variable of ysv.ybn are checked
+  when packing. Labels of ysl.ybn are sorted by id and their range index is
+  rebuilt; instruct files have no ids, they are taken from the labels of
+  the same name in the original ysl.ybn.
+  The times of yst_list.ybn are Windows FILETIMEs shown as ISO-8601 in UTC;
+  raw numbers are accepted too. The VarCount, LblCount and TxtCount of
+  every listed script are recounted from the scripts, ysl.ybn and ysv.ybn
+  next to the input, replaced by those already written to the directory of
+  -new-ybn. Scripts that were rebuilt there, changed their counts or are
+  new get the current time. New scripts are added as a line like
+  yst00012.ybn => data\script\new.yst without time and counts. Packing
+  fails if a file of the game can't be loaded.
+
+About label ids:
+  -label-ids tells whether the ids of a ysl.ybn are the murmur2, crc32 or
+  adler32 of the encoded names and lists the labels that don't match; the
+  exit code is 1 if any doesn't. When packing ysl.ybn, labels without id,
+  with id 0 in json or not in the original ysl.ybn for instruct, get one
+  computed from their name. This needs all ids of the original ysl.ybn to
+  follow the same derivation, otherwise packing fails. Given ids are kept,
+  those not matching their name are reported.
+
+About checking a game:
+  -check loads ysc.ybn, ysl.ybn, yst_list.ybn, ysv.ybn, yst.ybn and the
+  scripts of a directory and checks them against each other: labels point
+  into existing scripts below their instruction count, JUMP and GOSUB go
+  to existing labels, opcodes are commands of ysc.ybn, the LblCount,
+  TxtCount and VarCount of yst_list.ybn match the labels, messages and
+  static variables of each script, yst.ybn has the totals of
+  yst_list.ybn, every script is listed and all files have the same
+  version. Files that can't be parsed are reported too. Run it after
+  repacking to catch broken builds before starting the game; the exit code
+  is 1 if problems are found.
+
+About translation files:
+  po and pot files hold the strings of YSTB, YSCM and YSER files together
+  with their context: msgctxt is the id of the string (script:instruction:
+  argument), the speaker is written as translator comment and the source
+  file from yst_list.ybn and label from ysl.ybn as references, if these files
+  are found next to the input. Give a directory as input to get one file for
+  the whole project; packing a directory writes all files into the
+  directory given by -new-ybn. Empty and fuzzy msgstr keep the msgid.
+  xliff files are XLIFF 2.0 with the same ids as units and the context as
+  notes. Only units in the translated, reviewed or final state are packed.
+  csv files (tsv if the name ends with .tsv) have the columns ID, Script,
+  Source, Label, Speaker, Kind, Original and Translation. Packing only needs
+  the ID and Translation columns, rows may be reordered or filtered.
+
+About line wrapping:
+  Japanese text is wrapped by the engine, translations usually need explicit
+  line breaks. -wrap-width sets the width of the message box in half-width
+  characters (a full-width character counts as two) and packing inserts
+  -wrap-break into every translated message so no line is wider than that.
+  Words are only split when they do not fit a line and tags like <...> are
+  never split. With -wrap-lines packing warns about messages with more lines
+  than the message box can show.
+
+About control sequences:
+  Tags like <RUBY text=...>, <WAIT 500> or <COLOR ...> and variables like
+  $name or @flag are kept verbatim in extracted text. Packing compares them
+  between every translated string and its original and warns about missing,
+  unexpected, unbalanced or malformed ones. Ruby readings may be translated.
+
+About pseudo-localization:
+  -pseudo packs every string as [Ŧéxţ~~~] before real translations exist:
+  letters get accents the code page can encode, -pseudo-expansion adds that
+  share of the width as padding and brackets mark start and end. Text
+  without brackets in the game is hardcoded elsewhere, cut brackets show
+  overflowing boxes. Control sequences are kept and -wrap-width applies.
+
+About the translation memory:
+  -tm collects the translated strings of a po, xliff or csv file into a tmx
+  file and lists every string that was translated in different ways. When
+  extracting, -tmx fills in the translation of every string found in the
+  memory. When packing, -tmx does the same for untranslated strings and
+  -propagate reuses translations of identical strings of the same project.
+
+About migrating translations:
+  When a patch changes the scripts, -migrate carries a translation of the old
+  build (-input) over to the new one (-new-input). Strings are matched by
+  their text and the strings before and after them, so moved and repeated
+  lines find their translation. Every new, removed and changed string is
+  listed; changed strings are left untranslated. -out is written as po, pot,
+  xliff, csv, tsv or txt depending on its extension. txt files only work
+  for single ybn files.
+
+About profiles:
+  Only the arguments of some es.* functions are extracted from calls, games
+  often define more functions that take text. -discover lists every call
+  function whose string arguments contain non-ASCII characters or sentences,
+  the most text first, and with -out writes the ones not yet extracted into
+  a profile. Remove what is not text and give it to every mode with
+  -profile:
+
+      {"TextFunctions": ["es.msg.log", "sys.title"]}
+
+  With -all-strings (or "AllStrings": true) the string arguments of all
+  other calls are extracted too, unless they look like numbers, ASCII file
+  names with a known extension or paths, or identifiers like es.msg.log,
+  flag_01 or saveData; single words like Yes stay text. Allow and Deny
+  rules override this by function pattern and a regular expression on the
+  text with its quotes, Deny first:
+
+      {"AllStrings": true,
+       "Allow": [{"Function": "sys.title"}],
+       "Deny": [{"Function": "es.file.*"}, {"Text": "^\"@"}]}
+
+About choice menus:
+  -menus groups the options set by consecutive es.sel.* calls into menus.
+  When ysc.ybn is next to the scripts, the IF variable == n ... JUMP or
+  GOSUB following a menu gives the label option n leads to. With a .json
+  -out the menus are written as records; with a translation format all
+  strings are, each menu as one string with an option per line and notes on
+  where the options lead. Existing translations given by -po, -xliff or
+  -csv are carried over. Packing such a file maps the lines back to the
+  options, so the translated menu must keep its number of lines.
+
+About the route graph:
+  -graph draws the story as a graph of the labels of ysl.ybn and the starts
+  of scripts without one. Edges are the options of choice menus, JUMP and
+  GOSUB targets and falling through to the next label; finding them needs
+  ysc.ybn next to the scripts. Nodes count the messages up to the next
+  label and show the first one. .dot or .gv files are for Graphviz, with a
+  cluster per script; .json has the same nodes and edges.
+
+About tracing routes:
+  -trace plays the game headless from -start, or the first script, and
+  writes the messages in the order a player sees them, with the options
+  taken as "> option" and the labels passed as "# label". It follows IF,
+  ELSE, LOOP, JUMP, GOSUB, RETURN and LET with their expressions, using
+  the command names of ysc.ybn; other commands are skipped and counted.
+  The trace stops at an IF whose condition can't be evaluated and tells
+  where, as the route after it would be a guess.
+  -choices are the options to take, 1 for the first, in the order the
+  menus come, followed by first or last for all other menus, like 2,1,last.
+  Translations given by -po, -xliff or -csv are shown instead of the
+  original text, to proofread a route in play order.
+
+About variable references:
+  -xref lists every variable of ysv.ybn, with its scope, type and initial
+  value, and every instruction of the scripts reading or writing it, with
+  the label it is under. The variable LET assigns to is a write, all other
+  variables, like the index of an array element, are reads. Variables the scripts use but ysv.ybn doesn't
+  declare are listed too. Written variables compared in IF are the route
+  flags. .json files get the same as records.
+
+About aligning releases:
+  -align pairs the strings of two releases of a game in different languages,
+  -input in -src-lang and -trg-input in -trg-lang with its own code page
+  -trg-cp. Scripts are matched by file name. Scripts built from the same
+  source are paired instruction by instruction, others between the labels
+  both have, by kind and length of the strings; if a label occurs twice,
+  the whole script is aligned at once. The pairs are written as tsv or tmx
+  depending on the extension of -out.
+
+About comparing builds:
+  -diff compares two versions of a ybn file, two directories of ybn files
+  or two ypf archives by their content instead of their bytes: scripts by
+  instruction as a unified diff, labels by name, the script list by script
+  id and other files field by field. Files only in one version are listed.
+  With -out the result is written to a file, as a list of changes if the
+  name ends with .json.
+
+About code pages:
+  -cp sets the encoding of the text in the game files: 932 (Shift-JIS, the
+  default), 936 (GBK), 949 (Korean), 950 (Big5), 1252 (Western) or utf-8.
+  With -cp auto the text of the input is decoded with every code page, the
+  score of each is printed and the most plausible one is used. Characters
+  the code page lacks are replaced when packing and listed afterwards.
+  Bytes that would not be packed back the same, like invalid bytes or the
+  IBM variants of NEC extensions, are extracted as escapes like \x{FA40}
+  and packed as these bytes again. A backslash that would start such an
+  escape is written as \x{5C}.
+
+About character substitution:
+  To show characters the font of the game lacks, map them to unused code
+  points and patch the font. -charmap reads a table with one mapping per
+  line, the character or its code point and the bytes of the replacement
+  code point in hex:
+
+      # accented latin in the user-defined area of Shift-JIS
+      é=F040
+      U+00E8=F041
+
+  Packing writes the code points for the characters and extraction turns
+  them back into the characters.
+
 About the key:
   The files use a 4-byte key XOR-Cipher. The Program can try to break it based
   on assumptions about the content. This should work with any standard
@@ -125,17 +327,6 @@ func parseCmdOps(cds string) (err error, ops [256]string) {
 	return
 }
 
-func parseCp(s string) int {
-	switch s {
-	case "936":
-		return codec.C936
-	case "932":
-		return codec.C932
-	default:
-		return codec.Unknown
-	}
-}
-
 func extractYbnFile(ybnName, outJsonName, outTxtName, outInstructName, outDecryptName string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
 	logln("reading file:", ybnName)
 	oriStm, err := os.ReadFile(ybnName)
@@ -148,18 +339,8 @@ func extractYbnFile(ybnName, outJsonName, outTxtName, outInstructName, outDecryp
 	binary.Read(stm, binary.LittleEndian, &magic)
 	switch strings.ToUpper(string(magic[:])) {
 	case "YSTB":
-		var header ystbHeader
-		stm.Seek(0, io.SeekStart)
-		binary.Read(stm, binary.LittleEndian, &header)
 		if guessKey {
-			guessedKey := [4]byte{}
-			id := binary.Size(header) + int(header.CodeSize) - 4
-			guessedKey[0] = oriStm[id]
-			guessedKey[1] = oriStm[id+1]
-			guessedKey[2] = oriStm[id+2]
-			guessedKey[3] = oriStm[id+3]
-			decryptBlock(guessedKey[:], []byte{12, 0, 0, 0})
-			return parseYstbFile(oriStm, outJsonName, outTxtName, outDecryptName, outInstructName, guessedKey[:], ops, codePage)
+			return parseYstbFile(oriStm, outJsonName, outTxtName, outDecryptName, outInstructName, guessYstbKey(oriStm), ops, codePage)
 		}
 		return parseYstbFile(oriStm, outJsonName, outTxtName, outDecryptName, outInstructName, key, ops, codePage)
 	case "YSLB":
@@ -182,7 +363,7 @@ func extractYbnFile(ybnName, outJsonName, outTxtName, outInstructName, outDecryp
 	}
 }
 
-func packYbnFile(ybnName, outTxtName, outInstructName, outYbnName string, key []byte, ops *[256]string, codePage int) bool {
+func packYbnFile(ybnName, outJsonName, outTxtName, outInstructName, outYbnName string, key []byte, guessKey bool, ops *[256]string, codePage int) bool {
 	logln("reading file:", ybnName)
 	oriStm, err := os.ReadFile(ybnName)
 	if err != nil {
@@ -194,13 +375,31 @@ func packYbnFile(ybnName, outTxtName, outInstructName, outYbnName string, key []
 	binary.Read(stm, binary.LittleEndian, &magic)
 	switch strings.ToUpper(string(magic[:])) {
 	case "YSTB":
-		return packYstbFile(oriStm, outTxtName, outYbnName, key, ops, codePage)
+		return packYstbFile(oriStm, scriptName(ybnName), outTxtName, outYbnName, key, ops, codePage)
 	case "YSCF":
 		return packYscfFile(oriStm, outInstructName, outYbnName, codePage)
 	case "YSCM":
 		return packYscmFile(oriStm, outTxtName, outYbnName, codePage)
 	case "YSER":
 		return packYserFile(oriStm, outTxtName, outYbnName, codePage)
+	case "YSLB":
+		if outJsonName == "" && outInstructName == "" {
+			fmt.Println("YSLB can only be packed from json or instruct")
+			return false
+		}
+		return packYslbFile(oriStm, outJsonName, outInstructName, outYbnName, codePage)
+	case "YSTL":
+		if outJsonName == "" && outInstructName == "" {
+			fmt.Println("YSTL can only be packed from json or instruct")
+			return false
+		}
+		return packYstlFile(oriStm, filepath.Dir(ybnName), outJsonName, outInstructName, outYbnName, key, guessKey, ops, codePage)
+	case "YSVR":
+		if outJsonName == "" {
+			fmt.Println("YSVR can only be packed from json")
+			return false
+		}
+		return packYsvrFile(outJsonName, outYbnName, codePage)
 	default:
 		fmt.Println("Unknown MAGIC-bytes or packing not supported")
 		return false
@@ -209,18 +408,52 @@ func packYbnFile(ybnName, outTxtName, outInstructName, outYbnName string, key []
 
 func main() {
 	retCode := 0
-	defer os.Exit(retCode)
+	defer func() { os.Exit(retCode) }()
 	isExtract := flag.Bool("e", false, "extract a file")
 	isPack := flag.Bool("p", false, "pack a ybn")
 	inInputName := flag.String("input", "", "input ybn file or directory name")
-	outJsonName := flag.String("json", "", "output json file name")
-	outInstructName := flag.String("instruct", "", "output instruct file name")
+	outJsonName := flag.String("json", "", "output json file name, or the json to pack ysl.ybn, yst_list.ybn or ysv.ybn from")
+	outInstructName := flag.String("instruct", "", "output instruct file name, or the instruct to pack yscfg.ybn, ysl.ybn or yst_list.ybn from")
 	outTxtName := flag.String("txt", "", "output txt file name")
 	outDecryptName := flag.String("decrypt", "", "output decrypted file name")
 	outYbnName := flag.String("new-ybn", "", "output ybn file name")
+	poName := flag.String("po", "", "po file name to extract to or pack from")
+	outPotName := flag.String("pot", "", "output pot file name")
+	xliffName := flag.String("xliff", "", "xliff 2.0 file name to extract to or pack from")
+	csvName := flag.String("csv", "", "csv or tsv file name to extract to or pack from")
+	tmxName := flag.String("tmx", "", "tmx translation memory to fill translations from, or to build with -tm")
+	propagate := flag.Bool("propagate", false, "use the translation of identical strings for untranslated ones when packing")
+	isBuildTm := flag.Bool("tm", false, "build a translation memory from translated strings")
+	isMigrate := flag.Bool("migrate", false, "migrate a translation to a new build of the game")
+	isDiff := flag.Bool("diff", false, "show the differences between two versions of a ybn, directory or ypf")
+	newInputName := flag.String("new-input", "", "ybn file, directory or ypf of the new build to migrate to or compare with")
+	outName := flag.String("out", "", "output file of -migrate, -diff, -align, -discover, -menus, -graph, -trace and -xref, the format is taken from the extension")
+	isDiscover := flag.Bool("discover", false, "rank the call functions by how much text they take")
+	profileName := flag.String("profile", "", "json profile with extraction settings of the game")
+	allStrings := flag.Bool("all-strings", false, "extract every string argument of calls that looks translatable")
+	isMenus := flag.Bool("menus", false, "extract the choice menus with their options and branches")
+	isGraph := flag.Bool("graph", false, "write the route graph of the game")
+	isTrace := flag.Bool("trace", false, "play the game headless and write the messages of a route in order")
+	startLabel := flag.String("start", "", "label to start -trace at, default is the first script")
+	choices := flag.String("choices", "first", "options -trace takes in menus, like 2,1,first")
+	maxSteps := flag.Int("max-steps", 1000000, "instructions -trace executes at most")
+	isXref := flag.Bool("xref", false, "list where the scripts read and write each variable")
+	isCheck := flag.Bool("check", false, "check the files of a game directory against each other")
+	isLabelIds := flag.Bool("label-ids", false, "verify the ids of the labels of a ysl.ybn against their names")
+	isAlign := flag.Bool("align", false, "align the strings of two releases in different languages")
+	trgInputName := flag.String("trg-input", "", "directory of the release in the target language for -align")
+	trgCodePage := flag.String("trg-cp", "", "code page of the -trg-input release, default is -cp")
+	pseudo := flag.Bool("pseudo", false, "pack all strings pseudo-localized")
+	pseudoExpansion := flag.Float64("pseudo-expansion", 0.3, "width added to pseudo-localized strings, relative to the original")
+	srcLang := flag.String("src-lang", "ja", "source language of translation files")
+	trgLang := flag.String("trg-lang", "en", "target language of translation files")
+	wrapWidth := flag.Int("wrap-width", 0, "wrap translated messages to this width in half-width characters when packing")
+	wrapLines := flag.Int("wrap-lines", 0, "warn about translated messages with more lines than this")
+	wrapBreak := flag.String("wrap-break", "\\n", "line break inserted by -wrap-width, escapes like \\n are allowed")
 	keyInt := flag.Int64("key", 0x96ac6fd3, "decode key")
 	guessKey := flag.Bool("guess-key", false, "try to guess the encryption key")
-	codePage := flag.String("cp", "932", "specify code page")
+	codePage := flag.String("cp", "932", "code page of the game: 932, 936, 949, 950, 1252, utf-8 or auto")
+	charMapName := flag.String("charmap", "", "character substitution table for the code page")
 	outputOpCode := flag.Bool("output-opcode", false, "output the opcode guessed")
 	inOpCodes := flag.String("ops", "", "specify op-code names like 90:msg,29:call")
 	verbose := flag.Bool("v", false, "verbose output")
@@ -241,16 +474,112 @@ func main() {
 	}
 	gIsOutputOpcode = *outputOpCode
 	gVerbose = *verbose
-	if (*isExtract && *isPack) || (!*isExtract && !*isPack) ||
-		((*isPack || *isExtract) && *inInputName == "") ||
-		(*isPack && (*outYbnName == "" || (*outTxtName == "" && *outInstructName == ""))) {
+	gWrap.Width = *wrapWidth
+	gWrap.MaxLines = *wrapLines
+	gWrap.Break = *wrapBreak
+	if lineBreak, err := strconv.Unquote("\"" + *wrapBreak + "\""); err == nil {
+		gWrap.Break = lineBreak
+	}
+	if gWrap.Break == "" {
+		gWrap.Break = "\n"
+	}
+	modes := 0
+	for _, mode := range []bool{*isExtract, *isPack, *isBuildTm, *isMigrate, *isDiff, *isAlign, *isDiscover, *isMenus, *isGraph, *isTrace, *isXref, *isLabelIds, *isCheck} {
+		if mode {
+			modes++
+		}
+	}
+	hasTranslation := *poName != "" || *xliffName != "" || *csvName != ""
+	if modes != 1 || *inInputName == "" ||
+		(*isPack && (*outYbnName == "" || (*outTxtName == "" && *outInstructName == "" && *outJsonName == "" && !hasTranslation && !*pseudo))) ||
+		(*isBuildTm && (*tmxName == "" || !hasTranslation)) ||
+		(*isMigrate && (*newInputName == "" || *outName == "" || (*outTxtName == "" && !hasTranslation))) ||
+		(*isDiff && *newInputName == "") ||
+		(*isAlign && (*trgInputName == "" || *outName == "")) ||
+		((*isMenus || *isGraph) && *outName == "") {
+		printUsage(os.Args[0])
+		return
+	}
+	cp, err := parseCp(*codePage)
+	if err != nil {
+		fmt.Println(err)
 		printUsage(os.Args[0])
 		return
 	}
+	if cp == cpAuto {
+		cp = detectInputCodePage(*inInputName, key[:], *guessKey)
+	}
+	if *profileName != "" {
+		gProfile, err = readProfile(*profileName)
+		if err != nil {
+			fmt.Println("reading profile:", err)
+			return
+		}
+	}
+	if *allStrings {
+		gProfile.AllStrings = true
+	}
+	trgCp := cp
+	if *trgCodePage != "" {
+		trgCp, err = parseCp(*trgCodePage)
+		if err != nil {
+			fmt.Println(err)
+			printUsage(os.Args[0])
+			return
+		}
+		if trgCp == cpAuto {
+			trgCp = detectInputCodePage(*trgInputName, key[:], *guessKey)
+		}
+	}
+	if *charMapName != "" {
+		gCharMap, err = readCharMap(*charMapName)
+		if err != nil {
+			fmt.Println("reading character table:", err)
+			return
+		}
+	}
 	if *isExtract {
-		extractYbnFile(*inInputName, *outJsonName, *outTxtName, *outInstructName, *outDecryptName, key[:], *guessKey, &opCodes, parseCp(*codePage))
+		if *outJsonName != "" || *outTxtName != "" || *outInstructName != "" || *outDecryptName != "" {
+			extractYbnFile(*inInputName, *outJsonName, *outTxtName, *outInstructName, *outDecryptName, key[:], *guessKey, &opCodes, cp)
+		}
+		if hasTranslation || *outPotName != "" {
+			extractTranslationFiles(*inInputName, *poName, *outPotName, *xliffName, *csvName, *tmxName, *srcLang, *trgLang, key[:], *guessKey, &opCodes, cp)
+		}
+	} else if *isBuildTm {
+		buildTranslationMemory(*inInputName, *poName, *xliffName, *csvName, *tmxName, *srcLang, *trgLang, key[:], *guessKey, &opCodes, cp)
+	} else if *isMigrate {
+		migrateTranslation(*inInputName, *newInputName, *outTxtName, *poName, *xliffName, *csvName, *outName, *srcLang, *trgLang, key[:], *guessKey, &opCodes, cp)
+	} else if *isDiscover {
+		printTextFunctions(*inInputName, *outName, key[:], *guessKey, &opCodes, cp)
+	} else if *isMenus {
+		extractChoiceMenus(*inInputName, *outName, *poName, *xliffName, *csvName, *srcLang, *trgLang, key[:], *guessKey, &opCodes, cp)
+	} else if *isGraph {
+		writeRouteGraph(*inInputName, *outName, key[:], *guessKey, &opCodes, cp)
+	} else if *isTrace {
+		traceRoute(*inInputName, *startLabel, *choices, *maxSteps, *outName, *poName, *xliffName, *csvName, key[:], *guessKey, &opCodes, cp)
+	} else if *isXref {
+		writeVariableRefs(*inInputName, *outName, key[:], *guessKey, &opCodes, cp)
+	} else if *isCheck {
+		if !checkGameFiles(*inInputName, key[:], *guessKey, &opCodes, cp) {
+			retCode = 1
+		}
+	} else if *isLabelIds {
+		if !verifyLabelIds(*inInputName, cp) {
+			retCode = 1
+		}
+	} else if *isAlign {
+		alignReleases(*inInputName, *trgInputName, *outName, *srcLang, *trgLang, key[:], *guessKey, &opCodes, cp, trgCp)
+	} else if *isDiff {
+		diffFiles(*inInputName, *newInputName, *outName, key[:], *guessKey, &opCodes, cp)
 	} else if *isPack {
-		packYbnFile(*inInputName, *outTxtName, *outInstructName, *outYbnName, key[:], &opCodes, parseCp(*codePage))
+		if *pseudo {
+			packPseudoLocalized(*inInputName, *outYbnName, *pseudoExpansion, key[:], *guessKey, &opCodes, cp)
+		} else if hasTranslation {
+			packTranslationFiles(*inInputName, *poName, *xliffName, *csvName, *tmxName, *propagate, *outYbnName, *srcLang, *trgLang, key[:], *guessKey, &opCodes, cp)
+		} else {
+			packYbnFile(*inInputName, *outJsonName, *outTxtName, *outInstructName, *outYbnName, key[:], *guessKey, &opCodes, cp)
+		}
+		printUnencodable()
 	} else {
 		printUsage(os.Args[0])
 		return
@@ -9,4 +9,4 @@ require (
 	github.com/regomne/eutil/textFile v0.0.0-20210629022305-0392e03e7f5c
 )
 
-require golang.org/x/text v0.9.0 // indirect
+require golang.org/x/text v0.9.0